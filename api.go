@@ -0,0 +1,87 @@
+package main
+
+import (
+	"doc/geek"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runAPI implements "rover api": it writes the exported API of the module
+// containing dir as a snapshot.
+func runAPI(args []string) error {
+	flags := flag.NewFlagSet("api", flag.ExitOnError)
+	output := flags.String("o", "", "write the snapshot to `file` (.json for JSON) instead of stdout")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: rover api [-o file] [dir]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	dir := "."
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	}
+	api, err := geek.ExtractAPI(dir)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		fmt.Print(api.Text())
+		return nil
+	}
+	return geek.WriteAPI(api, *output)
+}
+
+// runAPIDiff implements "rover apidiff": it compares two versions of the
+// API and reports whether the newer one breaks callers.
+func runAPIDiff(args []string) (breaking bool, err error) {
+	flags := flag.NewFlagSet("apidiff", flag.ExitOnError)
+	repo := flags.String("C", ".", "resolve git revisions in the repository containing `dir`")
+	asJSON := flags.Bool("json", false, "print the diff as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: rover apidiff [-C dir] [-json] <old> <new>")
+		fmt.Fprintln(flags.Output(), "Each version is a snapshot file, a module directory or a git revision.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	from, err := loadAPI(flags.Arg(0), *repo)
+	if err != nil {
+		return false, err
+	}
+	to, err := loadAPI(flags.Arg(1), *repo)
+	if err != nil {
+		return false, err
+	}
+	diff := geek.DiffAPI(from, to)
+
+	if *asJSON {
+		data, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return false, err
+		}
+		fmt.Println(string(data))
+	} else {
+		fmt.Print(diff.Text())
+	}
+	return len(diff.Breaking) > 0, nil
+}
+
+// loadAPI reads a snapshot file, extracts the API of a directory, or
+// extracts it at a git revision of repo.
+func loadAPI(version, repo string) (*geek.API, error) {
+	info, err := os.Stat(version)
+	switch {
+	case err == nil && info.IsDir():
+		return geek.ExtractAPI(version)
+	case err == nil:
+		return geek.LoadAPI(version)
+	}
+	return geek.APIAtRevision(repo, version)
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bufio"
+	"doc/doctor"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Reports doctor -write-reports writes into every directory it checks
+const (
+	docCoverageNote = "doc-coverage.md"
+	duplicatesNote  = "duplicates.md"
+	healthNote      = "health.md"
+)
+
+// runDoctor implements "rover doctor": it checks Go files and, with -fix,
+// applies the fixes the rules have for them after showing them. It fails
+// if there are findings as serious as -fail-on that aren't in the
+// baseline; -write-baseline records the current findings instead. For
+// directories it also measures the documentation coverage, failing if
+// that is below the minimum. Each -o writes the findings in a machine
+// format as well. Doctor leaves the checked tree alone unless asked:
+// -write-reports writes the report of each file, reports duplicate code,
+// the documentation coverage and the health of directories, and records
+// their health in the history. With -notes it only checks that the
+// generated notes are in sync with their sources, failing if any are not.
+func runDoctor(args []string) (failed bool, err error) {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fix := flags.Bool("fix", false, "show the patches fixing the findings and apply them")
+	yes := flags.Bool("y", false, "with -fix, apply the patches without asking")
+	failOn := flags.String("fail-on", string(doctor.SeverityError), "fail on new findings of at least `severity` (info, warning, error or none)")
+	writeBaseline := flags.Bool("write-baseline", false, "record the findings in the baseline instead of failing on them")
+	minCoverage := flags.Float64("min-doc-coverage", 0, "fail if less than `percent` of the exported API is documented (default from "+doctor.ConfigFile+", 0 turns the check off)")
+	writeReports := flags.Bool("write-reports", false, "write the reports of the files and directories into the checked tree and record the health history")
+	notes := flags.Bool("notes", false, "instead, check that the notes generated from the files are in sync with them")
+	var outs outputs
+	flags.Var(&outs, "o", "also write the findings as `format=path`, format being json, sarif or junit (repeatable)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: rover doctor [-fix [-y]] [-fail-on severity] [-write-baseline] [-write-reports] [-min-doc-coverage percent] [-o format=path ...] [file or dir ...]")
+		fmt.Fprintln(flags.Output(), "       rover doctor -notes [file or dir ...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	switch doctor.Severity(*failOn) {
+	case doctor.SeverityInfo, doctor.SeverityWarning, doctor.SeverityError, "none":
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	// Only an explicit -min-doc-coverage overrides the configuration
+	minimum := -1.0
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "min-doc-coverage" {
+			minimum = *minCoverage
+		}
+	})
+
+	roots := flags.Args()
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	if *notes {
+		return checkNotes(roots)
+	}
+	results, err := checkFiles(roots, *fix, *yes, *writeReports)
+	if err != nil {
+		return false, err
+	}
+	if err := writeOutputs(outs, results); err != nil {
+		return false, err
+	}
+
+	if *writeBaseline {
+		written, err := doctor.WriteBaselines(results)
+		if err != nil {
+			return false, err
+		}
+		for _, path := range written {
+			fmt.Println("Baseline written to", path)
+		}
+	} else if *failOn != "none" {
+		fresh := 0
+		for _, findings := range results {
+			for _, f := range findings {
+				if !f.Baseline && f.Severity.AtLeast(doctor.Severity(*failOn)) {
+					fresh++
+				}
+			}
+		}
+		if fresh > 0 {
+			fmt.Printf("%d new findings of severity %s or worse\n", fresh, *failOn)
+			failed = true
+		}
+	}
+
+	for _, root := range roots {
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			continue
+		}
+		if *writeReports {
+			if err := writeDuplicates(root); err != nil {
+				return false, err
+			}
+			if err := writeHealth(root); err != nil {
+				return false, err
+			}
+		}
+		ok, err := checkDocCoverage(root, minimum, *writeReports)
+		if err != nil {
+			return false, err
+		}
+		failed = failed || !ok
+	}
+	return failed, nil
+}
+
+// checkNotes reports the notes among roots that are stale, orphaned or
+// missing, and fails if there are any. Unmanaged notes are listed too but
+// don't fail the check.
+func checkNotes(roots []string) (failed bool, err error) {
+	var problems []*doctor.NoteProblem
+	for _, root := range roots {
+		info, err := os.Stat(root)
+		if err != nil {
+			return false, err
+		}
+		if info.IsDir() {
+			found, err := doctor.CheckNotes(root)
+			if err != nil {
+				return false, err
+			}
+			problems = append(problems, found...)
+			continue
+		}
+		problem, err := doctor.CheckNote(root)
+		if err != nil {
+			return false, err
+		}
+		if problem != nil {
+			problems = append(problems, problem)
+		}
+	}
+	stale := 0
+	for _, p := range problems {
+		fmt.Println(p)
+		if p.Status.Failed() {
+			stale++
+		}
+	}
+	if stale == 0 {
+		fmt.Println("All notes are in sync.")
+		return false, nil
+	}
+	fmt.Printf("%d notes out of sync; run rover on the repository to regenerate the stale and missing ones, and delete the orphaned ones\n", stale)
+	return true, nil
+}
+
+// output is a machine-readable file -o asks for.
+type output struct{ format, path string }
+
+// outputs collects the -o flags.
+type outputs []output
+
+func (o *outputs) String() string {
+	var list []string
+	for _, out := range *o {
+		list = append(list, out.format+"="+out.path)
+	}
+	return strings.Join(list, ",")
+}
+
+func (o *outputs) Set(value string) error {
+	format, path, ok := strings.Cut(value, "=")
+	if !ok || path == "" {
+		return fmt.Errorf("want format=path, got %q", value)
+	}
+	switch format {
+	case doctor.FormatJSON, doctor.FormatSARIF, doctor.FormatJUnit:
+	default:
+		return fmt.Errorf("unknown format %q, want json, sarif or junit", format)
+	}
+	*o = append(*o, output{format, path})
+	return nil
+}
+
+// writeOutputs writes the findings by file in the formats outs asks for.
+func writeOutputs(outs outputs, findings map[string][]doctor.Finding) error {
+	if len(outs) == 0 {
+		return nil
+	}
+	var files []string
+	for file := range findings {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	var results []doctor.Result
+	for _, file := range files {
+		result, err := doctor.NewResult(file, findings[file])
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+
+	for _, out := range outs {
+		f, err := os.Create(out.path)
+		if err != nil {
+			return err
+		}
+		err = doctor.WriteOutput(f, out.format, results)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", out.path, err)
+		}
+		fmt.Printf("%s findings written to %s\n", out.format, out.path)
+	}
+	return nil
+}
+
+// writeDuplicates writes the report of the duplicate code under root.
+func writeDuplicates(root string) error {
+	clones, err := doctor.FindClones(root, doctor.CloneOptions{})
+	if err != nil {
+		return err
+	}
+	notePath := filepath.Join(root, duplicatesNote)
+	fmt.Printf("%d clone groups in %s, report written to %s\n", len(clones.Clones), root, notePath)
+	return doctor.WriteClones(clones, notePath)
+}
+
+// writeHealth scores the health of root, records it in root's history and
+// writes the report, naming the files that got worse since the last run.
+func writeHealth(root string) error {
+	notePath := filepath.Join(root, healthNote)
+	health, regressions, err := doctor.WriteHealth(root, notePath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Health of %s: %.1f (%s), report written to %s\n", root, health.Score, health.Grade(), notePath)
+	for _, r := range regressions {
+		fmt.Printf("%s got worse: %.1f -> %.1f\n", filepath.Join(root, r.Path), r.Before, r.After)
+	}
+	return nil
+}
+
+// checkDocCoverage measures the documentation coverage of root, writing
+// the report if write is set, and reports whether the coverage is at least
+// minimum, or the one configured for root's project if minimum is
+// negative.
+func checkDocCoverage(root string, minimum float64, write bool) (bool, error) {
+	if minimum < 0 {
+		config, err := doctor.FindConfig(root)
+		if err != nil {
+			return false, err
+		}
+		minimum = config.MinDocCoverage
+	}
+	coverage, err := doctor.DocCoverage(root)
+	if err != nil {
+		return false, err
+	}
+	fmt.Printf("Documentation coverage of %s: %.1f%% (%d of %d items)\n",
+		root, coverage.Percent(), coverage.Documented, coverage.Total)
+	if write {
+		notePath := filepath.Join(root, docCoverageNote)
+		if err := doctor.WriteCoverage(coverage, notePath); err != nil {
+			return false, err
+		}
+		fmt.Println("Documentation coverage report written to", notePath)
+	}
+	if coverage.Percent() < minimum {
+		fmt.Printf("Documentation coverage of %s is below the minimum of %.1f%%\n", root, minimum)
+		return false, nil
+	}
+	return true, nil
+}
+
+// checkFiles checks the Go files among roots, writing their reports if
+// write is set, and, if fix is set, applies the patches fixing them once
+// confirmed. It returns the findings by file.
+func checkFiles(roots []string, fix, yes, write bool) (map[string][]doctor.Finding, error) {
+	run := doctor.CheckFile
+	if write {
+		run = doctor.Run
+	}
+	files, err := goFiles(roots)
+	if err != nil {
+		return nil, err
+	}
+
+	results := map[string][]doctor.Finding{}
+	fixed := map[string][]byte{}
+	for _, file := range files {
+		findings, err := run(file)
+		if err != nil {
+			return nil, err
+		}
+		results[file] = findings
+		for _, f := range findings {
+			known := ""
+			if f.Baseline {
+				known = " (baseline)"
+			}
+			fmt.Printf("%s:%d:%d: %s %s: %s%s\n", file, f.Position.Line, f.Position.Column, f.Severity, f.Rule, f.Message, known)
+		}
+		if !fix {
+			continue
+		}
+		patch, source, err := doctor.FixFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if patch != "" {
+			fmt.Print(patch)
+			fixed[file] = source
+		}
+	}
+	if !fix {
+		return results, nil
+	}
+	if len(fixed) == 0 {
+		fmt.Println("Nothing to fix.")
+		return results, nil
+	}
+	if !yes && !confirm(fmt.Sprintf("Apply the patches to %d files?", len(fixed))) {
+		return results, nil
+	}
+	for _, file := range files {
+		source, ok := fixed[file]
+		if !ok {
+			continue
+		}
+		if err := os.WriteFile(file, source, 0644); err != nil {
+			return nil, err
+		}
+		// Bring the findings up to date with the fixed file
+		if results[file], err = run(file); err != nil {
+			return nil, err
+		}
+		fmt.Println("Fixed", file)
+	}
+	return results, nil
+}
+
+// goFiles lists the Go files among roots, walking directories but skipping
+// hidden ones, testdata and vendor.
+func goFiles(roots []string) ([]string, error) {
+	var files []string
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if doctor.SkipDir(root, path, d) {
+				return filepath.SkipDir
+			}
+			if d.IsDir() {
+				return nil
+			}
+			if filepath.Ext(path) == ".go" {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// confirm asks a yes/no question on the terminal.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,142 @@
+package doctor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// Baseline records the findings a project has accepted for now, so that
+// only new ones fail a run. Findings are recognized by file, rule and
+// message rather than by line, so code moving around doesn't make them
+// new.
+type Baseline struct {
+	Findings []BaselineEntry `json:"findings"`
+}
+
+// BaselineEntry is a finding in the baseline. Count is the number of
+// identical findings in the file.
+type BaselineEntry struct {
+	File    string `json:"file"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
+
+// LoadBaseline reads the baseline at path. A missing file is an empty
+// baseline.
+func LoadBaseline(path string) (*Baseline, error) {
+	b := &Baseline{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+// numbers are left out of the messages in the baseline: they are mostly
+// lines and measurements that change without the finding changing.
+var numbers = regexp.MustCompile(`[0-9]+`)
+
+func baselineMessage(msg string) string {
+	return numbers.ReplaceAllString(msg, "N")
+}
+
+type baselineKey struct{ file, rule, message string }
+
+// mark sets Baseline on the findings of the file at rel (relative to the
+// project) that the baseline knows about.
+func (b *Baseline) mark(rel string, findings []Finding) {
+	known := map[baselineKey]int{}
+	for _, e := range b.Findings {
+		if e.File == rel {
+			known[baselineKey{e.File, e.Rule, e.Message}] += e.Count
+		}
+	}
+	for i, f := range findings {
+		key := baselineKey{rel, f.Rule, baselineMessage(f.Message)}
+		if known[key] > 0 {
+			known[key]--
+			findings[i].Baseline = true
+		}
+	}
+}
+
+// set replaces what the baseline records for the file at rel with
+// findings.
+func (b *Baseline) set(rel string, findings []Finding) {
+	var entries []BaselineEntry
+	for _, e := range b.Findings {
+		if e.File != rel {
+			entries = append(entries, e)
+		}
+	}
+	counts := map[baselineKey]int{}
+	for _, f := range findings {
+		counts[baselineKey{rel, f.Rule, baselineMessage(f.Message)}]++
+	}
+	for key, count := range counts {
+		entries = append(entries, BaselineEntry{File: key.file, Rule: key.rule, Message: key.message, Count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Rule != b.Rule {
+			return a.Rule < b.Rule
+		}
+		return a.Message < b.Message
+	})
+	b.Findings = entries
+}
+
+// WriteBaselines records findings, by source file, in the baselines of the
+// projects the files belong to, replacing what those recorded for the
+// files. It returns the paths of the baselines it wrote.
+func WriteBaselines(findings map[string][]Finding) ([]string, error) {
+	baselines := map[string]*Baseline{}
+	var files []string
+	for file := range findings {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		p, err := findProject(file)
+		if err != nil {
+			return nil, err
+		}
+		path := p.baselinePath()
+		if baselines[path] == nil {
+			baselines[path] = p.baseline
+		}
+		baselines[path].set(p.rel(file), findings[file])
+	}
+
+	var written []string
+	for path, b := range baselines {
+		data, err := json.MarshalIndent(b, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			return nil, err
+		}
+		written = append(written, path)
+	}
+	sort.Strings(written)
+	return written, nil
+}
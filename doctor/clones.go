@@ -0,0 +1,499 @@
+package doctor
+
+import (
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"doc/geek"
+)
+
+// CloneOptions tune FindClones.
+type CloneOptions struct {
+	// MinTokens is the smallest clone reported, in tokens; it is also the
+	// size of the windows that are hashed. Defaults to 60.
+	MinTokens int
+	// MinSimilarity is the share of matching tokens below which two
+	// fragments are no longer near-duplicates. Defaults to 0.8.
+	MinSimilarity float64
+}
+
+// Fragment is a stretch of code that is part of a clone group.
+type Fragment struct {
+	Start  geek.Position `json:"start"`
+	End    geek.Position `json:"end"`
+	Tokens int           `json:"tokens"`
+}
+
+// Lines is the number of lines the fragment spans.
+func (f Fragment) Lines() int {
+	return f.End.Line - f.Start.Line + 1
+}
+
+// Clone is a group of fragments that are the same code once identifiers
+// and literals are ignored. Similarity is the share of tokens that match
+// between its least similar pair of fragments: 1 for exact clones, less
+// for near-duplicates with statements added or removed.
+type Clone struct {
+	Fragments  []Fragment `json:"fragments"`
+	Tokens     int        `json:"tokens"`
+	Lines      int        `json:"lines"`
+	Similarity float64    `json:"similarity"`
+}
+
+// CloneReport is the duplicate code found under a directory.
+type CloneReport struct {
+	Files  int     `json:"files"`
+	Clones []Clone `json:"clones"`
+}
+
+// cloneFile is a source file reduced to its normalized tokens.
+type cloneFile struct {
+	path   string
+	kinds  []int
+	starts []token.Position
+	ends   []token.Position
+}
+
+// FindClones finds duplicate and near-duplicate code in the Go files under
+// root. Files are reduced to token sequences in which every identifier and
+// every literal look the same, so renamed copies still match; windows of
+// MinTokens tokens are hashed to find the places where two sequences
+// agree, and runs of matching windows are joined, across small gaps for
+// near-duplicates, into clones. Tests, testdata, vendor and hidden
+// directories are skipped.
+func FindClones(root string, opts CloneOptions) (*CloneReport, error) {
+	if opts.MinTokens == 0 {
+		opts.MinTokens = 60
+	}
+	if opts.MinSimilarity == 0 {
+		opts.MinSimilarity = 0.8
+	}
+
+	paths, err := sourceFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	kinds := map[string]int{}
+	var files []*cloneFile
+	for _, path := range paths {
+		file, err := tokenize(path, kinds)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	pairs := matchWindows(files, opts.MinTokens)
+	var clones []clonePair
+	for key, matches := range pairs {
+		for _, pair := range joinMatches(matches, opts.MinTokens) {
+			pair.a, pair.b = key.a, key.b
+			// A repetitive stretch of one file matches itself shifted
+			if pair.a == pair.b && pair.aEnd > pair.bStart {
+				continue
+			}
+			if pair.similarity() >= opts.MinSimilarity {
+				clones = append(clones, pair)
+			}
+		}
+	}
+	return &CloneReport{Files: len(files), Clones: groupClones(files, clones)}, nil
+}
+
+// sourceFiles lists the Go files under root other than tests.
+func sourceFiles(root string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if SkipDir(root, path, d) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		if filepath.Ext(name) == ".go" && !strings.HasSuffix(name, "_test.go") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+// tokenize reads the tokens of the file at path, leaving out the package
+// clause and imports, which say nothing about duplicated logic. Kinds maps
+// each normalized token to a number.
+func tokenize(path string, kinds map[string]int) (*cloneFile, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var skip [][2]int
+	if parsed, _ := parser.ParseFile(fset, path, src, parser.ImportsOnly); parsed != nil {
+		offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+		skip = append(skip, [2]int{offset(parsed.Package), offset(parsed.Name.End())})
+		for _, decl := range parsed.Decls {
+			skip = append(skip, [2]int{offset(decl.Pos()), offset(decl.End())})
+		}
+	}
+
+	file := &cloneFile{path: path}
+	tf := fset.AddFile(path, -1, len(src))
+	var s scanner.Scanner
+	s.Init(tf, src, nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		// Also skip the semicolons ending the skipped declarations
+		offset := tf.Offset(pos)
+		if skipped(skip, offset) || tok == token.SEMICOLON && skipped(skip, offset-1) {
+			continue
+		}
+		norm := tok.String()
+		switch {
+		case tok == token.IDENT:
+			norm = "ident"
+		case tok.IsLiteral():
+			norm = "literal"
+		case tok == token.SEMICOLON && lit == "\n":
+			norm = ";"
+		}
+		kind, ok := kinds[norm]
+		if !ok {
+			kind = len(kinds)
+			kinds[norm] = kind
+		}
+		length := len(lit)
+		if length == 0 || lit == "\n" {
+			length = len(tok.String())
+		}
+		file.kinds = append(file.kinds, kind)
+		file.starts = append(file.starts, tf.Position(pos))
+		file.ends = append(file.ends, tf.Position(pos+token.Pos(length-1)))
+	}
+	return file, nil
+}
+
+// skipped reports whether offset lies in one of the ranges to skip.
+func skipped(ranges [][2]int, offset int) bool {
+	for _, r := range ranges {
+		if offset >= r[0] && offset < r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// maxWindowCopies is the number of copies of a window beyond which it is
+// ignored
+const maxWindowCopies = 50
+
+// filePair identifies two files, a ≤ b, by their index.
+type filePair struct{ a, b int }
+
+// windowMatch is a window starting at token i of one file that equals the
+// one starting at token j of the other.
+type windowMatch struct{ i, j int }
+
+// matchWindows hashes every window of size tokens and returns the pairs of
+// equal windows per pair of files.
+func matchWindows(files []*cloneFile, size int) map[filePair][]windowMatch {
+	type location struct{ file, start int }
+	const base = 1000003
+	index := map[uint64][]location{}
+	for f, file := range files {
+		if len(file.kinds) < size {
+			continue
+		}
+		var h, power uint64 = 0, 1
+		for i := 0; i < size; i++ {
+			h = h*base + uint64(file.kinds[i]+1)
+			if i > 0 {
+				power *= base
+			}
+		}
+		for start := 0; ; start++ {
+			index[h] = append(index[h], location{f, start})
+			end := start + size
+			if end >= len(file.kinds) {
+				break
+			}
+			h = (h-uint64(file.kinds[start]+1)*power)*base + uint64(file.kinds[end]+1)
+		}
+	}
+
+	same := func(x, y location) bool {
+		a, b := files[x.file].kinds[x.start:x.start+size], files[y.file].kinds[y.start:y.start+size]
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+	pairs := map[filePair][]windowMatch{}
+	for _, locations := range index {
+		// Boilerplate so common it is everywhere isn't worth comparing
+		if len(locations) > maxWindowCopies {
+			continue
+		}
+		for x := 0; x < len(locations); x++ {
+			for y := x + 1; y < len(locations); y++ {
+				p, q := locations[x], locations[y]
+				// Overlapping windows of one file repeat, e.g., a long
+				// run of similar statements; that is not a clone
+				if p.file == q.file && q.start-p.start < size {
+					continue
+				}
+				if same(p, q) {
+					key := filePair{p.file, q.file}
+					pairs[key] = append(pairs[key], windowMatch{p.start, q.start})
+				}
+			}
+		}
+	}
+	return pairs
+}
+
+// clonePair is a fragment of file a, tokens [aStart, aEnd), that clones the
+// fragment [bStart, bEnd) of file b, with matched tokens in common. diagonal
+// is the offset between the two at the last matching window.
+type clonePair struct {
+	a, b         int
+	aStart, aEnd int
+	bStart, bEnd int
+	matched      int
+	diagonal     int
+}
+
+func (p clonePair) similarity() float64 {
+	return float64(p.matched) / float64(max(p.aEnd-p.aStart, p.bEnd-p.bStart))
+}
+
+// joinMatches joins runs of matching windows into clone pairs. In an exact
+// clone the windows follow each other on one diagonal (i-j); a run that
+// starts shortly after the previous one ends, in both files, continues a
+// near-duplicate in which a few tokens were added or removed.
+func joinMatches(matches []windowMatch, size int) []clonePair {
+	sort.Slice(matches, func(x, y int) bool {
+		if matches[x].i != matches[y].i {
+			return matches[x].i < matches[y].i
+		}
+		return matches[x].j < matches[y].j
+	})
+	gap := size / 2
+	var pairs []clonePair
+	for _, m := range matches {
+		joined := false
+		for k := len(pairs) - 1; k >= 0 && !joined; k-- {
+			p := &pairs[k]
+			if m.i > p.aEnd+gap || m.j < p.bStart || m.j > p.bEnd+gap {
+				continue
+			}
+			diagonal := m.i - m.j
+			if diagonal < p.diagonal-gap || diagonal > p.diagonal+gap {
+				continue
+			}
+			// Count only the tokens this window adds
+			if end := m.i + size; end > p.aEnd {
+				p.matched += end - max(m.i, p.aEnd)
+				p.aEnd = end
+			}
+			p.bEnd = max(p.bEnd, m.j+size)
+			p.diagonal = diagonal
+			joined = true
+		}
+		if !joined {
+			pairs = append(pairs, clonePair{
+				aStart: m.i, aEnd: m.i + size,
+				bStart: m.j, bEnd: m.j + size,
+				matched: size, diagonal: m.i - m.j,
+			})
+		}
+	}
+	return pairs
+}
+
+// cloneNode is a fragment in the graph groupClones builds.
+type cloneNode struct {
+	file, start, end int
+	parent           int
+}
+
+// groupClones turns clone pairs into groups: fragments of one file that
+// overlap are the same fragment, and fragments cloning each other,
+// directly or through others, are a group.
+func groupClones(files []*cloneFile, pairs []clonePair) []Clone {
+	var nodes []cloneNode
+	find := func(n int) int {
+		for nodes[n].parent != n {
+			nodes[n].parent = nodes[nodes[n].parent].parent
+			n = nodes[n].parent
+		}
+		return n
+	}
+	union := func(x, y int) { nodes[find(x)].parent = find(y) }
+	node := func(file, start, end int) int {
+		nodes = append(nodes, cloneNode{file: file, start: start, end: end, parent: len(nodes)})
+		n := len(nodes) - 1
+		for other := 0; other < n; other++ {
+			o := nodes[other]
+			if o.file == file && o.start < end && start < o.end {
+				union(n, other)
+			}
+		}
+		return n
+	}
+
+	similarity := map[int]float64{}
+	for _, p := range pairs {
+		x := node(p.a, p.aStart, p.aEnd)
+		y := node(p.b, p.bStart, p.bEnd)
+		union(x, y)
+		sim := p.similarity()
+		for _, n := range []int{x, y} {
+			if s, ok := similarity[n]; !ok || sim < s {
+				similarity[n] = sim
+			}
+		}
+	}
+
+	// Merge the fragments of each group per file
+	type span struct{ start, end int }
+	groups := map[int]map[int][]span{}
+	groupSimilarity := map[int]float64{}
+	for n, nd := range nodes {
+		root := find(n)
+		if groups[root] == nil {
+			groups[root] = map[int][]span{}
+			groupSimilarity[root] = 1
+		}
+		groups[root][nd.file] = append(groups[root][nd.file], span{nd.start, nd.end})
+		groupSimilarity[root] = min(groupSimilarity[root], similarity[n])
+	}
+
+	var clones []Clone
+	for root, byFile := range groups {
+		clone := Clone{Similarity: groupSimilarity[root]}
+		for f, spans := range byFile {
+			sort.Slice(spans, func(x, y int) bool { return spans[x].start < spans[y].start })
+			merged := []span{spans[0]}
+			for _, s := range spans[1:] {
+				last := &merged[len(merged)-1]
+				if s.start < last.end {
+					last.end = max(last.end, s.end)
+				} else {
+					merged = append(merged, s)
+				}
+			}
+			file := files[f]
+			for _, s := range merged {
+				fragment := Fragment{
+					Start:  position(file.starts[s.start]),
+					End:    position(file.ends[s.end-1]),
+					Tokens: s.end - s.start,
+				}
+				clone.Fragments = append(clone.Fragments, fragment)
+				clone.Tokens = max(clone.Tokens, fragment.Tokens)
+				clone.Lines = max(clone.Lines, fragment.Lines())
+			}
+		}
+		sort.Slice(clone.Fragments, func(x, y int) bool {
+			a, b := clone.Fragments[x].Start, clone.Fragments[y].Start
+			if a.File != b.File {
+				return a.File < b.File
+			}
+			return a.Line < b.Line
+		})
+		clones = append(clones, clone)
+	}
+	sort.Slice(clones, func(x, y int) bool {
+		a, b := clones[x], clones[y]
+		if a.duplicated() != b.duplicated() {
+			return a.duplicated() > b.duplicated()
+		}
+		return a.Fragments[0].Start.String() < b.Fragments[0].Start.String()
+	})
+	return clones
+}
+
+// duplicated is the number of lines that would go if the clone were
+// written once.
+func (c Clone) duplicated() int {
+	return c.Lines * (len(c.Fragments) - 1)
+}
+
+func position(p token.Position) geek.Position {
+	return geek.Position{File: p.Filename, Line: p.Line, Column: p.Column}
+}
+
+// cloneFamilies is the number of clone groups drawn in the report
+const cloneFamilies = 5
+
+// ClonesMarkdown renders the clone groups with links relative to noteDir,
+// and draws the biggest ones as a graph of the fragments in each.
+func ClonesMarkdown(r *CloneReport, noteDir string) string {
+	var b strings.Builder
+	b.WriteString("# Duplicate code\n\n")
+	if len(r.Clones) == 0 {
+		fmt.Fprintf(&b, "No duplicate code in %d files.\n", r.Files)
+		return b.String()
+	}
+	duplicated := 0
+	for _, c := range r.Clones {
+		duplicated += c.duplicated()
+	}
+	fmt.Fprintf(&b, "%d clone groups in %d files; writing each once would save about %d lines.\n\n",
+		len(r.Clones), r.Files, duplicated)
+
+	b.WriteString("## Biggest clone families\n\n")
+	b.WriteString("```mermaid\ngraph LR\n")
+	for i, c := range r.Clones[:min(len(r.Clones), cloneFamilies)] {
+		fmt.Fprintf(&b, "  subgraph clone%d [\"Clone %d: %d lines, %.0f%% similar\"]\n", i+1, i+1, c.Lines, 100*c.Similarity)
+		for j, f := range c.Fragments {
+			fmt.Fprintf(&b, "    c%d_%d[\"%s\"]\n", i+1, j, fragmentLabel(f, noteDir))
+		}
+		b.WriteString("  end\n")
+		for j := 1; j < len(c.Fragments); j++ {
+			fmt.Fprintf(&b, "  c%d_0 --- c%d_%d\n", i+1, i+1, j)
+		}
+	}
+	b.WriteString("```\n\n")
+
+	b.WriteString("## Clone groups\n\n")
+	b.WriteString("| # | Lines | Tokens | Similarity | Fragments |\n")
+	b.WriteString("| --- | --- | --- | --- | --- |\n")
+	for i, c := range r.Clones {
+		var links []string
+		for _, f := range c.Fragments {
+			links = append(links, fmt.Sprintf("%s–%d", geek.Link(f.Start, noteDir), f.End.Line))
+		}
+		fmt.Fprintf(&b, "| %d | %d | %d | %.0f%% | %s |\n", i+1, c.Lines, c.Tokens, 100*c.Similarity, strings.Join(links, "<br>"))
+	}
+	return b.String()
+}
+
+func fragmentLabel(f Fragment, noteDir string) string {
+	file := filepath.ToSlash(f.Start.File)
+	if rel, err := filepath.Rel(noteDir, f.Start.File); err == nil {
+		file = filepath.ToSlash(rel)
+	}
+	return fmt.Sprintf("%s:%d-%d", file, f.Start.Line, f.End.Line)
+}
+
+// WriteClones writes the duplicate code report to path.
+func WriteClones(r *CloneReport, path string) error {
+	return os.WriteFile(path, []byte(ClonesMarkdown(r, filepath.Dir(path))), 0644)
+}
@@ -0,0 +1,227 @@
+package doctor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigFile is the repository configuration doctor shares with geek's
+// architecture checks; doctor reads its "doctor" section.
+const ConfigFile = ".documentor.json"
+
+// BaselineFile is where the baseline is kept unless the configuration
+// says otherwise.
+const BaselineFile = ".doctor-baseline.json"
+
+// Config configures doctor for a repository.
+type Config struct {
+	// MinDocCoverage fails the run when less than this percentage of the
+	// exported API is documented. Zero disables the check.
+	MinDocCoverage float64 `json:"minDocCoverage,omitempty"`
+
+	// Severity overrides the severity of rules by ID.
+	Severity map[string]Severity `json:"severity,omitempty"`
+
+	// Disable turns rules off everywhere. IDs may be patterns, e.g. SEC*.
+	Disable []string `json:"disable,omitempty"`
+
+	// Paths turn rules off, or back on, for the files matching a pattern.
+	// Later entries take precedence.
+	Paths []PathRules `json:"paths,omitempty"`
+
+	// Baseline is the baseline file, relative to the configuration.
+	// Defaults to BaselineFile.
+	Baseline string `json:"baseline,omitempty"`
+}
+
+// PathRules enables and disables rules for the files matching Pattern, a
+// slash-separated glob relative to the configuration in which ** matches
+// any number of directories.
+type PathRules struct {
+	Pattern string   `json:"pattern"`
+	Enable  []string `json:"enable,omitempty"`
+	Disable []string `json:"disable,omitempty"`
+}
+
+// LoadConfig reads the doctor section of the configuration file at path.
+// A missing file is an empty configuration.
+func LoadConfig(path string) (*Config, error) {
+	var file struct {
+		Doctor Config `json:"doctor"`
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &file.Doctor, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for id, severity := range file.Doctor.Severity {
+		switch severity {
+		case SeverityInfo, SeverityWarning, SeverityError:
+		default:
+			return nil, fmt.Errorf("%s: unknown severity %q for %s", path, severity, id)
+		}
+	}
+	return &file.Doctor, nil
+}
+
+// Enabled reports whether the rule with the given ID applies to the file
+// at rel, a slash-separated path relative to the configuration.
+func (c *Config) Enabled(id, rel string) bool {
+	enabled := !matchesAny(c.Disable, id)
+	for _, p := range c.Paths {
+		if !matchPath(p.Pattern, rel) {
+			continue
+		}
+		if matchesAny(p.Disable, id) {
+			enabled = false
+		}
+		if matchesAny(p.Enable, id) {
+			enabled = true
+		}
+	}
+	return enabled
+}
+
+// rulesFor returns the rules enabled for the file at rel, with their
+// severities overridden.
+func (c *Config) rulesFor(rel string, rules []Rule) []Rule {
+	var enabled []Rule
+	for _, rule := range rules {
+		if !c.Enabled(rule.ID, rel) {
+			continue
+		}
+		if severity, ok := c.Severity[rule.ID]; ok {
+			rule.Severity = severity
+		}
+		enabled = append(enabled, rule)
+	}
+	return enabled
+}
+
+// matchesAny reports whether id matches one of patterns.
+func matchesAny(patterns []string, id string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath matches a slash-separated path against a glob in which a **
+// element matches any number of directories.
+func matchPath(pattern, name string) bool {
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchElems(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], name[0])
+	return ok && matchElems(pattern[1:], name[1:])
+}
+
+// project is the configuration that applies to a file. Its directory is
+// the nearest one above the file with a configuration, a baseline or a
+// go.mod.
+type project struct {
+	dir      string
+	config   *Config
+	baseline *Baseline
+}
+
+// FindConfig loads the configuration of the project containing the
+// directory dir, which may be set in dir or any of its parents.
+func FindConfig(dir string) (*Config, error) {
+	p, err := findProjectFrom(dir)
+	if err != nil {
+		return nil, err
+	}
+	return p.config, nil
+}
+
+// findProject loads the project containing the file at filePath.
+func findProject(filePath string) (*project, error) {
+	return findProjectFrom(filepath.Dir(filePath))
+}
+
+// findProjectFrom loads the project containing the directory dir: the
+// nearest of dir and its parents with a configuration, a baseline or a
+// go.mod, or dir itself if there is none.
+func findProjectFrom(dir string) (*project, error) {
+	start, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	p := &project{dir: start, config: &Config{}}
+	for dir := start; ; {
+		if isProjectDir(dir) {
+			p.dir = dir
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+
+	if p.config, err = LoadConfig(filepath.Join(p.dir, ConfigFile)); err != nil {
+		return nil, err
+	}
+	if p.baseline, err = LoadBaseline(p.baselinePath()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func isProjectDir(dir string) bool {
+	for _, name := range []string{ConfigFile, BaselineFile, "go.mod"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *project) baselinePath() string {
+	if p.config.Baseline != "" {
+		return filepath.Join(p.dir, filepath.FromSlash(p.config.Baseline))
+	}
+	return filepath.Join(p.dir, BaselineFile)
+}
+
+// rel returns the slash-separated path of filePath relative to the
+// project.
+func (p *project) rel(filePath string) string {
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		return filepath.ToSlash(filePath)
+	}
+	rel, err := filepath.Rel(p.dir, abs)
+	if err != nil {
+		return filepath.ToSlash(filePath)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,328 @@
+package doctor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"doc/geek"
+)
+
+// DocItem is an exported declaration, or a package, that should have a
+// doc comment.
+type DocItem struct {
+	Kind     string        `json:"kind"`
+	Name     string        `json:"name"`
+	Position geek.Position `json:"position"`
+}
+
+// PackageCoverage is the documentation coverage of one package. Missing
+// lists the items without a proper doc comment.
+type PackageCoverage struct {
+	Name       string          `json:"name"`
+	Dir        string          `json:"dir"`
+	Documented int             `json:"documented"`
+	Total      int             `json:"total"`
+	Missing    []DocItem       `json:"missing,omitempty"`
+	Files      []*FileCoverage `json:"files,omitempty"`
+}
+
+// FileCoverage counts the items declared in one file of a package.
+type FileCoverage struct {
+	Path       string `json:"path"`
+	Documented int    `json:"documented"`
+	Total      int    `json:"total"`
+}
+
+// Percent is the share of the file's items that are documented.
+func (f *FileCoverage) Percent() float64 {
+	return percent(f.Documented, f.Total)
+}
+
+// Percent is the share of the package's items that are documented.
+func (p *PackageCoverage) Percent() float64 {
+	return percent(p.Documented, p.Total)
+}
+
+// Coverage is the documentation coverage of the packages under a
+// directory.
+type Coverage struct {
+	Packages   []*PackageCoverage `json:"packages"`
+	Documented int                `json:"documented"`
+	Total      int                `json:"total"`
+}
+
+// Percent is the share of all items that are documented.
+func (c *Coverage) Percent() float64 {
+	return percent(c.Documented, c.Total)
+}
+
+func percent(documented, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(documented) / float64(total)
+}
+
+// DocCoverage measures how much of the exported API of the packages under
+// root is documented: exported types, functions, methods of exported
+// types, constants and variables, and the packages themselves. An item
+// counts as documented if its doc comment starts with its name ("Package
+// name" for packages), as go doc expects; members of a const or var group
+// are also covered by a comment on the group. Tests, testdata, vendor and
+// hidden directories are skipped.
+func DocCoverage(root string) (*Coverage, error) {
+	coverage := &Coverage{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if SkipDir(root, path, d) {
+			return filepath.SkipDir
+		}
+		pkgs, err := packageCoverage(path)
+		if err != nil {
+			return err
+		}
+		for _, pkg := range pkgs {
+			coverage.Packages = append(coverage.Packages, pkg)
+			coverage.Documented += pkg.Documented
+			coverage.Total += pkg.Total
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return coverage, nil
+}
+
+// packageCoverage measures the packages in dir, which is usually just one.
+// Files that don't parse are measured as far as they do; SYN001 reports
+// them.
+func packageCoverage(dir string) ([]*PackageCoverage, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	pkgs := map[string]map[string]*ast.File{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".go" || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		file, _ := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if file == nil || file.Name == nil {
+			continue
+		}
+		if pkgs[file.Name.Name] == nil {
+			pkgs[file.Name.Name] = map[string]*ast.File{}
+		}
+		pkgs[file.Name.Name][path] = file
+	}
+	var names []string
+	for name := range pkgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result []*PackageCoverage
+	for _, name := range names {
+		var files []string
+		for path := range pkgs[name] {
+			files = append(files, path)
+		}
+		sort.Strings(files)
+
+		pkg := &PackageCoverage{Name: name, Dir: filepath.ToSlash(dir)}
+		byFile := map[string]*FileCoverage{}
+		for _, path := range files {
+			byFile[path] = &FileCoverage{Path: filepath.ToSlash(path)}
+			pkg.Files = append(pkg.Files, byFile[path])
+		}
+		check := func(kind, name string, pos token.Pos, documented bool) {
+			p := fset.Position(pos)
+			file := byFile[p.Filename]
+			pkg.Total++
+			file.Total++
+			if documented {
+				pkg.Documented++
+				file.Documented++
+				return
+			}
+			pkg.Missing = append(pkg.Missing, DocItem{
+				Kind:     kind,
+				Name:     name,
+				Position: geek.Position{File: p.Filename, Line: p.Line, Column: p.Column},
+			})
+		}
+
+		var pkgDoc *ast.CommentGroup
+		for _, path := range files {
+			if doc := pkgs[name][path].Doc; doc != nil && pkgDoc == nil {
+				pkgDoc = doc
+			}
+		}
+		first := pkgs[name][files[0]]
+		check("package", name, first.Package, documentsPackage(pkgDoc, name))
+
+		exportedTypes := map[string]bool{}
+		for _, path := range files {
+			for _, decl := range pkgs[name][path].Decls {
+				if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.TYPE {
+					for _, spec := range gen.Specs {
+						if ts := spec.(*ast.TypeSpec); ts.Name.IsExported() {
+							exportedTypes[ts.Name.Name] = true
+						}
+					}
+				}
+			}
+		}
+
+		for _, path := range files {
+			for _, decl := range pkgs[name][path].Decls {
+				switch decl := decl.(type) {
+				case *ast.FuncDecl:
+					if !decl.Name.IsExported() {
+						continue
+					}
+					if decl.Recv == nil {
+						check("func", decl.Name.Name, decl.Pos(), documents(decl.Doc, decl.Name.Name))
+						continue
+					}
+					recv := receiverName(decl.Recv.List[0].Type)
+					if exportedTypes[recv] {
+						check("method", recv+"."+decl.Name.Name, decl.Pos(), documents(decl.Doc, decl.Name.Name))
+					}
+				case *ast.GenDecl:
+					checkGenDecl(decl, check)
+				}
+			}
+		}
+		result = append(result, pkg)
+	}
+	return result, nil
+}
+
+func checkGenDecl(decl *ast.GenDecl, check func(kind, name string, pos token.Pos, documented bool)) {
+	kind := decl.Tok.String()
+	if decl.Tok == token.IMPORT {
+		return
+	}
+	grouped := decl.Lparen.IsValid()
+	for _, spec := range decl.Specs {
+		switch spec := spec.(type) {
+		case *ast.TypeSpec:
+			if !spec.Name.IsExported() {
+				continue
+			}
+			doc := spec.Doc
+			if !grouped {
+				doc = decl.Doc
+			}
+			check(kind, spec.Name.Name, spec.Pos(), documents(doc, spec.Name.Name))
+		case *ast.ValueSpec:
+			for _, name := range spec.Names {
+				if !name.IsExported() {
+					continue
+				}
+				var documented bool
+				if grouped {
+					documented = documents(spec.Doc, name.Name) || decl.Doc != nil
+				} else {
+					documented = documents(decl.Doc, name.Name)
+				}
+				check(kind, name.Name, name.Pos(), documented)
+			}
+		}
+	}
+}
+
+// documents reports whether doc is a proper doc comment for name: it
+// starts with the name, possibly after an article.
+func documents(doc *ast.CommentGroup, name string) bool {
+	if doc == nil {
+		return false
+	}
+	text := doc.Text()
+	for _, article := range []string{"A ", "An ", "The "} {
+		text = strings.TrimPrefix(text, article)
+	}
+	rest, ok := strings.CutPrefix(text, name)
+	return ok && (rest == "" || !isIdentRune(rest[0]))
+}
+
+func documentsPackage(doc *ast.CommentGroup, name string) bool {
+	if doc == nil {
+		return false
+	}
+	// Commands are described by what they do rather than by their package
+	if name == "main" {
+		return strings.TrimSpace(doc.Text()) != ""
+	}
+	return documents(doc, "Package "+name)
+}
+
+func isIdentRune(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func receiverName(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(e.X)
+	case *ast.IndexExpr:
+		return receiverName(e.X)
+	case *ast.IndexListExpr:
+		return receiverName(e.X)
+	case *ast.Ident:
+		return e.Name
+	}
+	return ""
+}
+
+// CoverageMarkdown renders the coverage per package with the items that
+// lack documentation, linked relative to noteDir.
+func CoverageMarkdown(c *Coverage, noteDir string) string {
+	var b strings.Builder
+	b.WriteString("# Documentation coverage\n\n")
+	fmt.Fprintf(&b, "%.1f%% of the exported API is documented (%d of %d items).\n\n", c.Percent(), c.Documented, c.Total)
+	if len(c.Packages) == 0 {
+		return b.String()
+	}
+
+	b.WriteString("| Package | Directory | Coverage | Documented |\n")
+	b.WriteString("| --- | --- | --- | --- |\n")
+	for _, pkg := range c.Packages {
+		fmt.Fprintf(&b, "| `%s` | %s | %.1f%% | %d/%d |\n", pkg.Name, pkg.Dir, pkg.Percent(), pkg.Documented, pkg.Total)
+	}
+
+	for _, pkg := range c.Packages {
+		if len(pkg.Missing) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n## %s (%s)\n\n", pkg.Name, pkg.Dir)
+		b.WriteString("| Item | Kind | Location |\n")
+		b.WriteString("| --- | --- | --- |\n")
+		for _, item := range pkg.Missing {
+			fmt.Fprintf(&b, "| `%s` | %s | %s |\n", item.Name, item.Kind, geek.Link(item.Position, noteDir))
+		}
+	}
+	return b.String()
+}
+
+// WriteCoverage writes the coverage report to path.
+func WriteCoverage(c *Coverage, path string) error {
+	return os.WriteFile(path, []byte(CoverageMarkdown(c, filepath.Dir(path))), 0644)
+}
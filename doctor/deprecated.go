@@ -0,0 +1,306 @@
+package doctor
+
+import (
+	"fmt"
+	"go/ast"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Deprecation is a deprecated standard library API and what replaces it.
+// Old and New are import path and name, e.g. io/ioutil.ReadFile. DropIn
+// says whether New can be substituted without changing the code around
+// it; Note explains what to change when it can't.
+type Deprecation struct {
+	Old    string
+	New    string
+	Since  string
+	DropIn bool
+	Note   string
+}
+
+// Deprecations is the table of deprecated APIs DEP001 reports and, for
+// drop-in replacements, fixes.
+var Deprecations = []Deprecation{
+	{Old: "io/ioutil.ReadAll", New: "io.ReadAll", Since: "1.16", DropIn: true},
+	{Old: "io/ioutil.ReadFile", New: "os.ReadFile", Since: "1.16", DropIn: true},
+	{Old: "io/ioutil.WriteFile", New: "os.WriteFile", Since: "1.16", DropIn: true},
+	{Old: "io/ioutil.TempFile", New: "os.CreateTemp", Since: "1.16", DropIn: true},
+	{Old: "io/ioutil.TempDir", New: "os.MkdirTemp", Since: "1.16", DropIn: true},
+	{Old: "io/ioutil.NopCloser", New: "io.NopCloser", Since: "1.16", DropIn: true},
+	{Old: "io/ioutil.Discard", New: "io.Discard", Since: "1.16", DropIn: true},
+	{Old: "io/ioutil.ReadDir", New: "os.ReadDir", Since: "1.16",
+		Note: "os.ReadDir returns []os.DirEntry rather than []fs.FileInfo; call Info on an entry where the FileInfo is needed"},
+	{Old: "os.SEEK_SET", New: "io.SeekStart", Since: "1.7", DropIn: true},
+	{Old: "os.SEEK_CUR", New: "io.SeekCurrent", Since: "1.7", DropIn: true},
+	{Old: "os.SEEK_END", New: "io.SeekEnd", Since: "1.7", DropIn: true},
+	{Old: "reflect.PtrTo", New: "reflect.PointerTo", Since: "1.22", DropIn: true},
+	{Old: "strings.Title", New: "golang.org/x/text/cases.Title", Since: "1.18",
+		Note: "strings.Title doesn't handle Unicode punctuation; cases.Title takes a language.Tag"},
+	{Old: "math/rand.Seed", Since: "1.20",
+		Note: "the global generator is seeded randomly; use rand.New(rand.NewSource(seed)) where a fixed sequence is needed"},
+}
+
+// splitAPI splits io/ioutil.ReadFile into its import path and name.
+func splitAPI(api string) (importPath, name string) {
+	i := strings.LastIndex(api, ".")
+	return api[:i], api[i+1:]
+}
+
+// shortAPI is how code refers to api by default, e.g. ioutil.ReadFile.
+func shortAPI(api string) string {
+	importPath, name := splitAPI(api)
+	return path.Base(importPath) + "." + name
+}
+
+var deprecatedRule = Rule{
+	ID:          "DEP001",
+	Severity:    SeverityWarning,
+	Description: "A deprecated standard library API is used",
+	Check: func(in *Input) []Finding {
+		var findings []Finding
+		for _, use := range deprecatedUses(in) {
+			d := use.deprecation
+			msg := fmt.Sprintf("%s is deprecated since Go %s", use.expr, d.Since)
+			fix := d.Note
+			switch {
+			case d.DropIn:
+				msg += fmt.Sprintf("; use %s", shortAPI(d.New))
+				fix = fmt.Sprintf("Replace it with %s, which behaves the same; `rover doctor -fix` does this for you.", shortAPI(d.New))
+			case d.New != "":
+				msg += fmt.Sprintf("; use %s", shortAPI(d.New))
+			}
+			findings = append(findings, Finding{
+				Message:  msg,
+				Position: in.Position(use.sel.Pos()),
+				Fix:      fix,
+			})
+		}
+		return findings
+	},
+	Fix: fixDeprecated,
+}
+
+// deprecatedUse is a reference to a deprecated API in the source.
+type deprecatedUse struct {
+	sel         *ast.SelectorExpr
+	expr        string
+	spec        *ast.ImportSpec
+	deprecation Deprecation
+}
+
+// imports maps the names the file refers to its imports by to the specs.
+func imports(file *ast.File) map[string]*ast.ImportSpec {
+	specs := map[string]*ast.ImportSpec{}
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path.Base(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		specs[name] = spec
+	}
+	return specs
+}
+
+func importPath(spec *ast.ImportSpec) string {
+	p, _ := strconv.Unquote(spec.Path.Value)
+	return p
+}
+
+func deprecatedUses(in *Input) []deprecatedUse {
+	_, file := in.AST()
+	if file == nil {
+		return nil
+	}
+	table := map[string]Deprecation{}
+	for _, d := range Deprecations {
+		table[d.Old] = d
+	}
+	specs := imports(file)
+
+	var uses []deprecatedUse
+	ast.Inspect(file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		pkg, ok := sel.X.(*ast.Ident)
+		// Package names aren't resolved to objects; locals shadowing them are
+		if !ok || pkg.Obj != nil || specs[pkg.Name] == nil {
+			return true
+		}
+		spec := specs[pkg.Name]
+		if d, ok := table[importPath(spec)+"."+sel.Sel.Name]; ok {
+			uses = append(uses, deprecatedUse{sel: sel, expr: pkg.Name + "." + sel.Sel.Name, spec: spec, deprecation: d})
+		}
+		return true
+	})
+	return uses
+}
+
+// fixDeprecated replaces drop-in deprecations, adds the imports the
+// replacements need and removes the imports nothing uses any more.
+func fixDeprecated(in *Input) []Edit {
+	uses := deprecatedUses(in)
+	_, file := in.AST()
+	if file == nil {
+		return nil
+	}
+	specs := imports(file)
+	localName := map[string]string{}
+	for name, spec := range specs {
+		localName[importPath(spec)] = name
+	}
+
+	var edits []Edit
+	var added []string
+	fixed := map[*ast.ImportSpec]int{}
+	var anchor *ast.ImportSpec
+	for _, use := range uses {
+		if !use.deprecation.DropIn {
+			continue
+		}
+		newPath, newName := splitAPI(use.deprecation.New)
+		name, ok := localName[newPath]
+		if !ok {
+			name = path.Base(newPath)
+			localName[newPath] = name
+			added = append(added, newPath)
+		}
+		edits = append(edits, Edit{
+			Start: in.Offset(use.sel.Pos()),
+			End:   in.Offset(use.sel.End()),
+			New:   name + "." + newName,
+		})
+		fixed[use.spec]++
+		if anchor == nil {
+			anchor = use.spec
+		}
+	}
+	if len(edits) == 0 {
+		return nil
+	}
+
+	// Imports whose every use was replaced go, the first making room for
+	// the added ones
+	var unused []*ast.ImportSpec
+	for name, spec := range specs {
+		if fixed[spec] > 0 && fixed[spec] == selectorsOf(file, name) {
+			unused = append(unused, spec)
+		}
+	}
+	for _, spec := range unused {
+		if spec == anchor {
+			edits = append(edits, replaceImport(in, file, spec, added))
+			added = nil
+		}
+	}
+	for _, spec := range unused {
+		if spec != anchor {
+			edits = append(edits, replaceImport(in, file, spec, nil))
+		}
+	}
+	if len(added) > 0 {
+		edits = append(edits, insertImports(in, file, anchor, added))
+	}
+	return edits
+}
+
+// selectorsOf counts the references to the package imported as name.
+func selectorsOf(file *ast.File, name string) int {
+	count := 0
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == name && pkg.Obj == nil {
+				count++
+			}
+		}
+		return true
+	})
+	return count
+}
+
+// importDecl returns the import declaration spec belongs to.
+func importDecl(file *ast.File, spec *ast.ImportSpec) *ast.GenDecl {
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok {
+			for _, s := range gen.Specs {
+				if s == spec {
+					return gen
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// lineStart returns the offset of the start of the line containing offset.
+func lineStart(src []byte, offset int) int {
+	for offset > 0 && src[offset-1] != '\n' {
+		offset--
+	}
+	return offset
+}
+
+// lineEnd returns the offset just past the newline ending the line
+// containing offset.
+func lineEnd(src []byte, offset int) int {
+	for offset < len(src) && src[offset] != '\n' {
+		offset++
+	}
+	return min(offset+1, len(src))
+}
+
+// replaceImport replaces spec with imports of paths, or removes it if
+// there are none.
+func replaceImport(in *Input, file *ast.File, spec *ast.ImportSpec, paths []string) Edit {
+	decl := importDecl(file, spec)
+	if decl.Lparen.IsValid() {
+		start := lineStart(in.Source, in.Offset(spec.Pos()))
+		indent := string(in.Source[start:in.Offset(spec.Pos())])
+		var b strings.Builder
+		for _, p := range paths {
+			b.WriteString(indent + strconv.Quote(p) + "\n")
+		}
+		return Edit{Start: start, End: lineEnd(in.Source, in.Offset(spec.End())), New: b.String()}
+	}
+	if len(paths) == 0 {
+		return Edit{Start: in.Offset(decl.Pos()), End: lineEnd(in.Source, in.Offset(decl.End())), New: ""}
+	}
+	return Edit{Start: in.Offset(decl.Pos()), End: in.Offset(decl.End()), New: importText(paths)}
+}
+
+// insertImports adds imports of paths before anchor.
+func insertImports(in *Input, file *ast.File, anchor *ast.ImportSpec, paths []string) Edit {
+	decl := importDecl(file, anchor)
+	if decl.Lparen.IsValid() {
+		start := lineStart(in.Source, in.Offset(anchor.Pos()))
+		indent := string(in.Source[start:in.Offset(anchor.Pos())])
+		var b strings.Builder
+		for _, p := range paths {
+			b.WriteString(indent + strconv.Quote(p) + "\n")
+		}
+		return Edit{Start: start, End: start, New: b.String()}
+	}
+	start := in.Offset(decl.Pos())
+	return Edit{Start: start, End: start, New: importText(paths) + "\n"}
+}
+
+// importText declares imports of paths.
+func importText(paths []string) string {
+	if len(paths) == 1 {
+		return "import " + strconv.Quote(paths[0])
+	}
+	var b strings.Builder
+	b.WriteString("import (\n")
+	for _, p := range paths {
+		b.WriteString("\t" + strconv.Quote(p) + "\n")
+	}
+	b.WriteString(")")
+	return b.String()
+}
@@ -1,184 +1,194 @@
 package doctor
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
-	"net/http"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
-)
-
-const cloudflareAPIEndpoint = "https://api.cloudflare.com/client/v4/accounts/0843a42dc7915eb7a5ca1e3bb05cfce2/ai/run/@cf/meta/llama-2-7b-chat-int8"
-const accessToken = "wwJH-Ts41Wquh49IXlT50krftRa4E3w7SbAq7gL3"
-
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
 
+	"doc/geek"
+)
 
-func sendToCloudflare(mdFilename string) error {
-    // Read Markdown file content
-    content, err := ioutil.ReadFile(mdFilename)
-    if err != nil {
-        return err
-    }
-
-    // Create messages slice
-   messages := []Message{
-    {"system", "You specialize in generating Mermaid Markdown syntax for Go projects."},
-    {"user", fmt.Sprintf("Generate a Mermaid Markdown overview for the following Go file:\n```go\n%s\n```", content)},
+// ReportPath is where Run writes the report for a source file: foo.go
+// gets foo.doctor.md next to it.
+func ReportPath(filePath string) string {
+	return strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".doctor.md"
 }
 
-    // Prepare input JSON
-    inputs := map[string]interface{}{"messages": messages}
-    inputJSON, err := json.Marshal(inputs)
-    if err != nil {
-        return err
-    }
-
-    // Create HTTP request
-    req, err := http.NewRequest("POST", cloudflareAPIEndpoint, bytes.NewBuffer(inputJSON))
-    if err != nil {
-        return err
-    }
-
-    // Set Authorization and Content-Type headers
-    req.Header.Set("Authorization", "Bearer "+accessToken)
-    req.Header.Set("Content-Type", "application/json")
-
-    // Make the request
-    client := &http.Client{}
-    resp, err := client.Do(req)
-    if err != nil {
-        log.Fatalf("Error making request to Cloudflare API: %v", err)
-        return err
-    }
-    defer resp.Body.Close()
-// Unmarshal JSON response into the result struct
-var result struct {
-    Result struct {
-        Response string `json:"response"`
-    } `json:"result"`
+// Run checks the source file at filePath and writes the findings to its
+// report, together with the patch that applies the fixes rules have for
+// them. The rules are Rules as configured for the project the file belongs
+// to; findings silenced by an ignore directive are dropped, and those in
+// the project's baseline are marked. Run uses the analysis geek wrote next
+// to the file when that is up to date, and analyzes the file itself
+// otherwise.
+func Run(filePath string) ([]Finding, error) {
+	in, rules, findings, err := check(filePath)
+	if err != nil {
+		return nil, err
+	}
+	patch, _, err := fix(in, rules)
+	if err != nil {
+		return nil, err
+	}
+	reportPath := ReportPath(filePath)
+	if err := os.WriteFile(reportPath, []byte(Report(filePath, findings, patch, filepath.Dir(reportPath))), 0644); err != nil {
+		return nil, err
+	}
+	return findings, nil
 }
 
-  responseBody, err := io.ReadAll(resp.Body)
-    if err != nil {
-        log.Fatalf("Error reading response body: %v", err)
-        return err
-    }
-
-	log.Println(string(responseBody))
-
-
-if err := json.Unmarshal(responseBody, &result); err != nil {
-    log.Fatalf("Error unmarshaling JSON response: %v", err)
-    return err
+// CheckFile checks the source file at filePath like Run, without writing
+// its report.
+func CheckFile(filePath string) ([]Finding, error) {
+	_, _, findings, err := check(filePath)
+	return findings, err
 }
 
-log.Println(result.Result.Response)
-
-// Append the response to the Markdown file
-responseMarkdown := fmt.Sprintf("```mermaid\n\n%s\n\n```\n", result.Result.Response)
-newContent := string(content) + "\n" + responseMarkdown
-
-    // Update the Markdown file
-    err = os.WriteFile(mdFilename, []byte(newContent), 0644)
-    if err != nil {
-        return err
-    }
-
-    return nil
+// check applies the rules configured for the file at filePath, dropping
+// suppressed findings and marking those in the baseline. It also returns
+// the input and the rules it used.
+func check(filePath string) (*Input, []Rule, []Finding, error) {
+	in, err := newInput(filePath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	p, err := findProject(filePath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rel := p.rel(filePath)
+	rules := p.config.rulesFor(rel, Rules)
+	findings := suppress(in, Check(in, rules))
+	p.baseline.mark(rel, findings)
+	return in, rules, findings, nil
 }
 
-
-
- func Run(filePath string)  {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run script.go <filepath>")
-		return
+// FixFile returns the source file at filePath with the fixes of the rules
+// enabled for it applied, and the patch between the two. The patch is
+// empty if there is nothing to fix.
+func FixFile(filePath string) (patch string, fixed []byte, err error) {
+	in, err := newInput(filePath)
+	if err != nil {
+		return "", nil, err
 	}
-
-	filepathParam := os.Args[1]
-
-	// Get filename without extension
-	filename := strings.TrimSuffix(filepath.Base(filepathParam), filepath.Ext(filepathParam))
-
-	// Create JSON filename
-	jsonFilename := filename + ".json"
-
-	// Create MD filename
-	mdFilename := filename + ".md"
-
-	// Create .doctor.md filename
-	doctorFilename := filename + ".doctor.md"
-
-	// Require and process JSON file
-	processJSONFile(jsonFilename)
-
-	// Require and log MD file for each key-value pair in JSON
-	logMDFile(mdFilename)
-
-	// Write logs to .doctor.md file
-	writeLogsToDoctorFile(doctorFilename)
+	p, err := findProject(filePath)
+	if err != nil {
+		return "", nil, err
+	}
+	return fix(in, p.config.rulesFor(p.rel(filePath), Rules))
 }
 
-func processJSONFile(filename string) {
-	file, err := ioutil.ReadFile(filename)
+func newInput(filePath string) (*Input, error) {
+	source, err := os.ReadFile(filePath)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-
-	var data map[string]interface{}
-	if err := json.Unmarshal(file, &data); err != nil {
-		log.Fatal(err)
+	analysis, err := loadAnalysis(filePath, source)
+	if err != nil {
+		return nil, err
 	}
+	return &Input{Path: filePath, Source: source, Analysis: analysis}, nil
+}
 
-	fmt.Printf("Processing %s:\n", filename)
-	for key, value := range data {
-		// Perform any specific processing/logic here based on key-value pairs
-		fmt.Printf("Key: %s, Value: %v\n", key, value)
+func fix(in *Input, rules []Rule) (patch string, fixed []byte, err error) {
+	fixed, err = Fix(in, rules)
+	if err != nil {
+		return "", nil, err
 	}
+	return Patch(filepath.ToSlash(in.Path), in.Source, fixed), fixed, nil
 }
 
-func logMDFile(filename string) {
-	file, err := os.Create(filename)
-	if err != nil {
-		log.Fatal(err)
+// loadAnalysis reads geek's JSON for filePath unless it is missing, older
+// than the source, or made for the file under another path, whose
+// positions would then be reported next to those of filePath.
+func loadAnalysis(filePath string, source []byte) (*geek.AnalysisResult, error) {
+	jsonPath := geek.JSONPath(filePath)
+	if jsonInfo, err := os.Stat(jsonPath); err == nil {
+		if srcInfo, err := os.Stat(filePath); err == nil && !jsonInfo.ModTime().Before(srcInfo.ModTime()) {
+			if result, err := geek.LoadResult(jsonPath); err == nil {
+				if file := analyzedAs(result); file == "" || filepath.Clean(file) == filepath.Clean(filePath) {
+					return result, nil
+				}
+			}
+		}
 	}
-	defer file.Close()
+	return geek.AnalyzeSource(filePath, source, geek.Options{})
+}
 
-	// Log to MD file for each key-value pair in JSON
-	log.SetOutput(file)
+// analyzedAs returns the path the file of result was analyzed under, as
+// its positions record it, or "" if it has none the rules use.
+func analyzedAs(result *geek.AnalysisResult) string {
+	switch {
+	case len(result.Declarations) > 0:
+		return result.Declarations[0].Start.File
+	case len(result.FunctionCalls) > 0:
+		return result.FunctionCalls[0].File
+	case result.Metrics != nil && len(result.Metrics.Functions) > 0:
+		return result.Metrics.Functions[0].File
+	}
+	return ""
+}
 
-	// Example log message, modify as needed
-	log.Println("Log entry for MD file.")
+// SkipDir reports whether a walk of root skips the directory d at path:
+// hidden directories, testdata and vendor, unless they are root itself.
+func SkipDir(root, path string, d fs.DirEntry) bool {
+	name := d.Name()
+	return d.IsDir() && path != root && (strings.HasPrefix(name, ".") || name == "testdata" || name == "vendor")
 }
 
-func writeLogsToDoctorFile(filename string) {
-	// Open or create .doctor.md file
-	file, err := os.Create(filename)
-	if err != nil {
-		log.Fatal(err)
+// Report renders findings and the patch fixing them as the Markdown report
+// of filePath, with links relative to noteDir. Findings in the baseline
+// are listed apart from the new ones.
+func Report(filePath string, findings []Finding, patch, noteDir string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Doctor report for %s\n\n", filepath.Base(filePath))
+	if len(findings) == 0 {
+		b.WriteString("No findings.\n")
+		return b.String()
 	}
-	defer file.Close()
 
-	// Read MD log file
-	mdLogContent, err := ioutil.ReadFile(filename + ".md")
-	if err != nil {
-		log.Fatal(err)
+	var fresh, known []Finding
+	counts := map[Severity]int{}
+	for _, f := range findings {
+		counts[f.Severity]++
+		if f.Baseline {
+			known = append(known, f)
+		} else {
+			fresh = append(fresh, f)
+		}
+	}
+	fmt.Fprintf(&b, "%d findings: %d errors, %d warnings, %d info.",
+		len(findings), counts[SeverityError], counts[SeverityWarning], counts[SeverityInfo])
+	if len(known) > 0 {
+		fmt.Fprintf(&b, " %d of them are in the baseline.", len(known))
 	}
+	b.WriteString("\n\n")
 
-	// Write MD log content to .doctor.md file
-	_, err = file.Write(mdLogContent)
-	if err != nil {
-		log.Fatal(err)
+	if len(fresh) > 0 {
+		findingsTable(&b, fresh, noteDir)
+	}
+	if len(known) > 0 {
+		b.WriteString("\n## Baseline\n\n")
+		b.WriteString("These findings were accepted when the baseline was written and don't fail the run.\n\n")
+		findingsTable(&b, known, noteDir)
+	}
+
+	if patch != "" {
+		b.WriteString("\n## Patch\n\n")
+		b.WriteString("This patch fixes what can be fixed automatically; `rover doctor -fix` applies it.\n\n")
+		fmt.Fprintf(&b, "```diff\n%s```\n", patch)
 	}
+	return b.String()
+}
 
-	fmt.Printf("Logs written to %s\n", filename)
+func findingsTable(b *strings.Builder, findings []Finding, noteDir string) {
+	b.WriteString("| Severity | Rule | Message | Location | Fix |\n")
+	b.WriteString("| --- | --- | --- | --- | --- |\n")
+	escape := strings.NewReplacer("|", `\|`, "\n", " ")
+	for _, f := range findings {
+		fmt.Fprintf(b, "| %s | %s | %s | %s | %s |\n", f.Severity, f.Rule, escape.Replace(f.Message),
+			geek.Link(f.Position, noteDir), escape.Replace(f.Fix))
+	}
 }
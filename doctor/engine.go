@@ -0,0 +1,116 @@
+package doctor
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+
+	"doc/geek"
+)
+
+// Severity says how serious a finding is.
+type Severity string
+
+// Severities, from least to most serious
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// AtLeast reports whether s is as serious as other.
+func (s Severity) AtLeast(other Severity) bool {
+	rank := map[Severity]int{SeverityInfo: 1, SeverityWarning: 2, SeverityError: 3}
+	return rank[s] >= rank[other]
+}
+
+// Finding is a problem a rule found in a file. Fix suggests how to resolve
+// it. Baseline is set for findings the project's baseline already knows.
+type Finding struct {
+	Rule     string        `json:"rule"`
+	Severity Severity      `json:"severity"`
+	Message  string        `json:"message"`
+	Position geek.Position `json:"position"`
+	Fix      string        `json:"fix,omitempty"`
+	Baseline bool          `json:"baseline,omitempty"`
+}
+
+// Input is what rules inspect: a source file and geek's analysis of it.
+type Input struct {
+	Path     string
+	Source   []byte
+	Analysis *geek.AnalysisResult
+
+	fset   *token.FileSet
+	file   *ast.File
+	parsed bool
+}
+
+// AST parses the source for rules that need more than the analysis. The
+// file is parsed once and shared; it is nil if the source doesn't parse.
+func (in *Input) AST() (*token.FileSet, *ast.File) {
+	if !in.parsed {
+		in.parsed = true
+		in.fset = token.NewFileSet()
+		file, err := parser.ParseFile(in.fset, in.Path, in.Source, parser.ParseComments)
+		if err == nil {
+			in.file = file
+		}
+	}
+	return in.fset, in.file
+}
+
+// Position converts pos in the parsed AST to a geek.Position.
+func (in *Input) Position(pos token.Pos) geek.Position {
+	fset, _ := in.AST()
+	p := fset.Position(pos)
+	return geek.Position{File: p.Filename, Line: p.Line, Column: p.Column}
+}
+
+// Offset converts pos in the parsed AST to a byte offset in Source.
+func (in *Input) Offset(pos token.Pos) int {
+	fset, _ := in.AST()
+	return fset.Position(pos).Offset
+}
+
+// Edit replaces the source between the byte offsets Start and End with New.
+type Edit struct {
+	Start, End int
+	New        string
+}
+
+// Rule is a check over one file. Check returns the rule's findings; their
+// Rule and Severity default to the rule's own. Rules that can resolve
+// their findings themselves also have a Fix returning the edits that do.
+type Rule struct {
+	ID          string
+	Severity    Severity
+	Description string
+	Check       func(in *Input) []Finding
+	Fix         func(in *Input) []Edit
+}
+
+// Check runs rules over in and returns their findings sorted by position.
+func Check(in *Input, rules []Rule) []Finding {
+	var findings []Finding
+	for _, rule := range rules {
+		for _, f := range rule.Check(in) {
+			if f.Rule == "" {
+				f.Rule = rule.ID
+			}
+			if f.Severity == "" {
+				f.Severity = rule.Severity
+			}
+			findings = append(findings, f)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i].Position, findings[j].Position
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return findings
+}
@@ -0,0 +1,425 @@
+package doctor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HistoryFile is where the health of a repository is recorded, in its
+// root.
+const HistoryFile = ".doctor-history.json"
+
+// Weights of the parts of the health score
+const (
+	findingsWeight   = 0.5
+	complexityWeight = 0.3
+	docsWeight       = 0.2
+)
+
+// findingCost is what a finding takes off the findings score, by severity.
+// Findings in the baseline count too: accepting them doesn't make them
+// healthy.
+var findingCost = map[Severity]float64{
+	SeverityError:   20,
+	SeverityWarning: 5,
+	SeverityInfo:    1,
+}
+
+// HealthScore is a weighted score from 0 to 100 with its parts: the
+// findings score loses points for each finding, the complexity score is
+// the share of each function's cognitive complexity that is within
+// bounds, weighted by the function's size, and the docs score is the
+// documentation coverage. Lines is the number of non-blank lines scored,
+// by which scores are weighted when they are combined.
+type HealthScore struct {
+	Score      float64 `json:"score"`
+	Findings   float64 `json:"findings"`
+	Complexity float64 `json:"complexity"`
+	Docs       float64 `json:"docs"`
+	Lines      int     `json:"lines"`
+}
+
+// Grade turns the score into a letter, A for 90 and up to F below 60.
+func (s HealthScore) Grade() string {
+	switch {
+	case s.Score >= 90:
+		return "A"
+	case s.Score >= 80:
+		return "B"
+	case s.Score >= 70:
+		return "C"
+	case s.Score >= 60:
+		return "D"
+	}
+	return "F"
+}
+
+// FileHealth is the health of a source file; Path is relative to the root
+// of the repository.
+type FileHealth struct {
+	Path string `json:"path"`
+	HealthScore
+}
+
+// PackageHealth is the health of the files in a directory.
+type PackageHealth struct {
+	Dir   string        `json:"dir"`
+	Files []*FileHealth `json:"files"`
+	HealthScore
+}
+
+// Health is the health of a repository.
+type Health struct {
+	Root     string           `json:"root"`
+	Packages []*PackageHealth `json:"packages"`
+	HealthScore
+}
+
+// Files lists the files of every package.
+func (h *Health) Files() []*FileHealth {
+	var files []*FileHealth
+	for _, pkg := range h.Packages {
+		files = append(files, pkg.Files...)
+	}
+	return files
+}
+
+// MeasureHealth scores the Go files under root, leaving out tests,
+// testdata, vendor and hidden directories, with the rules configured for
+// them.
+func MeasureHealth(root string) (*Health, error) {
+	paths, err := sourceFiles(root)
+	if err != nil {
+		return nil, err
+	}
+	coverage, err := DocCoverage(root)
+	if err != nil {
+		return nil, err
+	}
+	docs := map[string]*FileCoverage{}
+	for _, pkg := range coverage.Packages {
+		for _, f := range pkg.Files {
+			docs[f.Path] = f
+		}
+	}
+
+	h := &Health{Root: filepath.ToSlash(root)}
+	packages := map[string]*PackageHealth{}
+	for _, path := range paths {
+		in, _, findings, err := check(path)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil, err
+		}
+		file := &FileHealth{Path: filepath.ToSlash(rel), HealthScore: fileScore(in, findings, docs[filepath.ToSlash(path)])}
+
+		dir := filepath.ToSlash(filepath.Dir(rel))
+		if packages[dir] == nil {
+			packages[dir] = &PackageHealth{Dir: dir}
+			h.Packages = append(h.Packages, packages[dir])
+		}
+		packages[dir].Files = append(packages[dir].Files, file)
+	}
+
+	sort.Slice(h.Packages, func(i, j int) bool { return h.Packages[i].Dir < h.Packages[j].Dir })
+	var scores []HealthScore
+	for _, pkg := range h.Packages {
+		var files []HealthScore
+		for _, f := range pkg.Files {
+			files = append(files, f.HealthScore)
+		}
+		pkg.HealthScore = combine(files)
+		scores = append(scores, pkg.HealthScore)
+	}
+	h.HealthScore = combine(scores)
+	return h, nil
+}
+
+// fileScore scores one file from its findings, the complexity of its
+// functions and its documentation coverage, if it declares anything that
+// needs documenting.
+func fileScore(in *Input, findings []Finding, docs *FileCoverage) HealthScore {
+	s := HealthScore{Findings: 100, Complexity: 100, Docs: 100}
+	for _, line := range bytes.Split(in.Source, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			s.Lines++
+		}
+	}
+
+	for _, f := range findings {
+		s.Findings -= findingCost[f.Severity]
+	}
+	s.Findings = math.Max(s.Findings, 0)
+
+	if in.Analysis.Metrics != nil {
+		var within, total float64
+		for _, fn := range in.Analysis.Metrics.Functions {
+			size := float64(max(fn.LinesOfCode, 1))
+			total += size
+			within += size * math.Min(1, float64(maxCognitive)/float64(max(fn.Cognitive, 1)))
+		}
+		if total > 0 {
+			s.Complexity = 100 * within / total
+		}
+	}
+
+	if docs != nil {
+		s.Docs = docs.Percent()
+	}
+	s.Score = findingsWeight*s.Findings + complexityWeight*s.Complexity + docsWeight*s.Docs
+	return s
+}
+
+// combine averages scores weighted by their lines.
+func combine(scores []HealthScore) HealthScore {
+	var c HealthScore
+	for _, s := range scores {
+		c.Lines += s.Lines
+	}
+	if c.Lines == 0 {
+		return HealthScore{Score: 100, Findings: 100, Complexity: 100, Docs: 100}
+	}
+	for _, s := range scores {
+		w := float64(s.Lines) / float64(c.Lines)
+		c.Score += w * s.Score
+		c.Findings += w * s.Findings
+		c.Complexity += w * s.Complexity
+		c.Docs += w * s.Docs
+	}
+	return c
+}
+
+// HistoryEntry is the health of a repository at a commit.
+type HistoryEntry struct {
+	Commit   string             `json:"commit"`
+	Time     time.Time          `json:"time"`
+	Score    float64            `json:"score"`
+	Packages map[string]float64 `json:"packages"`
+	Files    map[string]float64 `json:"files"`
+}
+
+// History is the health of a repository over time, oldest first.
+type History struct {
+	Entries []HistoryEntry `json:"entries"`
+}
+
+// LoadHistory reads the history at path. A missing file is an empty
+// history.
+func LoadHistory(path string) (*History, error) {
+	h := &History{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return h, nil
+}
+
+// Last returns the latest entry, or nil.
+func (h *History) Last() *HistoryEntry {
+	if len(h.Entries) == 0 {
+		return nil
+	}
+	return &h.Entries[len(h.Entries)-1]
+}
+
+// Record adds the health measured at commit. Measuring the same commit
+// again replaces its entry, so the history keeps one entry per commit.
+func (h *History) Record(commit string, at time.Time, health *Health) {
+	entry := HistoryEntry{
+		Commit:   commit,
+		Time:     at.UTC(),
+		Score:    round(health.Score),
+		Packages: map[string]float64{},
+		Files:    map[string]float64{},
+	}
+	for _, pkg := range health.Packages {
+		entry.Packages[pkg.Dir] = round(pkg.Score)
+		for _, f := range pkg.Files {
+			entry.Files[f.Path] = round(f.Score)
+		}
+	}
+	if last := h.Last(); last != nil && last.Commit == commit {
+		*last = entry
+		return
+	}
+	h.Entries = append(h.Entries, entry)
+}
+
+// round keeps one decimal, which is as precise as the scores are shown.
+func round(score float64) float64 {
+	return math.Round(score*10) / 10
+}
+
+// Regression is a file whose score went down.
+type Regression struct {
+	Path   string  `json:"path"`
+	Before float64 `json:"before"`
+	After  float64 `json:"after"`
+}
+
+// Regressions lists the files whose score is lower in health than in
+// entry, worst first. Files that are new since entry are not listed.
+func Regressions(entry *HistoryEntry, health *Health) []Regression {
+	if entry == nil {
+		return nil
+	}
+	var result []Regression
+	for _, f := range health.Files() {
+		before, ok := entry.Files[f.Path]
+		if after := round(f.Score); ok && after < before {
+			result = append(result, Regression{Path: f.Path, Before: before, After: after})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.After-a.Before != b.After-b.Before {
+			return a.After-a.Before < b.After-b.Before
+		}
+		return a.Path < b.Path
+	})
+	return result
+}
+
+// gitCommit returns the commit checked out in dir, or "" outside of a git
+// repository.
+func gitCommit(dir string) string {
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func shortCommit(commit string) string {
+	if commit == "" {
+		return "(none)"
+	}
+	return commit[:min(len(commit), 7)]
+}
+
+// historyRows is how many entries the trend shows.
+const historyRows = 10
+
+// HealthMarkdown renders the health of a repository with its trend over
+// the history and the files that got worse since previous, the entry
+// recorded by the run before.
+func HealthMarkdown(h *Health, history *History, previous *HistoryEntry) string {
+	var b strings.Builder
+	b.WriteString("# Health\n\n")
+	fmt.Fprintf(&b, "The repository scores %.1f (%s): findings %.1f, complexity %.1f, docs %.1f, over %d lines.\n\n",
+		h.Score, h.Grade(), h.Findings, h.Complexity, h.Docs, h.Lines)
+	fmt.Fprintf(&b, "Scores weigh findings %.0f%%, complexity %.0f%% and documentation %.0f%%; packages and the repository average their files by lines.\n",
+		100*findingsWeight, 100*complexityWeight, 100*docsWeight)
+
+	entries := history.Entries[max(len(history.Entries)-historyRows, 0):]
+	if len(entries) > 1 {
+		b.WriteString("\n## Trend\n\n")
+		b.WriteString("```mermaid\nxychart-beta\n")
+		var labels, scores []string
+		for _, e := range entries {
+			labels = append(labels, `"`+shortCommit(e.Commit)+`"`)
+			scores = append(scores, fmt.Sprintf("%.1f", e.Score))
+		}
+		fmt.Fprintf(&b, "  x-axis [%s]\n  y-axis \"Score\" 0 --> 100\n  line [%s]\n```\n\n", strings.Join(labels, ", "), strings.Join(scores, ", "))
+		b.WriteString("| Commit | Date | Score | Change |\n")
+		b.WriteString("| --- | --- | --- | --- |\n")
+		for i, e := range entries {
+			change := ""
+			if i > 0 {
+				change = fmt.Sprintf("%+.1f", e.Score-entries[i-1].Score)
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %.1f | %s |\n", shortCommit(e.Commit), e.Time.Format("2006-01-02 15:04"), e.Score, change)
+		}
+	}
+
+	if previous != nil {
+		b.WriteString("\n## Worse since the last run\n\n")
+		regressions := Regressions(previous, h)
+		if len(regressions) == 0 {
+			fmt.Fprintf(&b, "No file got worse since the run at `%s`.\n", shortCommit(previous.Commit))
+		} else {
+			fmt.Fprintf(&b, "Compared with the run at `%s`:\n\n", shortCommit(previous.Commit))
+			b.WriteString("| File | Before | Now | Change |\n")
+			b.WriteString("| --- | --- | --- | --- |\n")
+			for _, r := range regressions {
+				fmt.Fprintf(&b, "| [%s](%s) | %.1f | %.1f | %+.1f |\n", r.Path, r.Path, r.Before, r.After, r.After-r.Before)
+			}
+		}
+	}
+
+	if len(h.Packages) == 0 {
+		return b.String()
+	}
+	b.WriteString("\n## Packages\n\n")
+	b.WriteString("| Package | Score | Grade | Findings | Complexity | Docs | Lines |\n")
+	b.WriteString("| --- | --- | --- | --- | --- | --- | --- |\n")
+	for _, pkg := range h.Packages {
+		fmt.Fprintf(&b, "| %s | %.1f | %s | %.1f | %.1f | %.1f | %d |\n",
+			pkg.Dir, pkg.Score, pkg.Grade(), pkg.Findings, pkg.Complexity, pkg.Docs, pkg.Lines)
+	}
+
+	files := h.Files()
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Score < files[j].Score })
+	b.WriteString("\n## Files\n\nWorst first.\n\n")
+	b.WriteString("| File | Score | Grade | Findings | Complexity | Docs | Lines |\n")
+	b.WriteString("| --- | --- | --- | --- | --- | --- | --- |\n")
+	for _, f := range files {
+		fmt.Fprintf(&b, "| [%s](%s) | %.1f | %s | %.1f | %.1f | %.1f | %d |\n",
+			f.Path, f.Path, f.Score, f.Grade(), f.Findings, f.Complexity, f.Docs, f.Lines)
+	}
+	return b.String()
+}
+
+// WriteHealth measures the health of the repository at root, records it
+// in the history at root and writes the report to notePath, which should
+// be in root for its links to work. It returns the health and the files
+// that got worse since the last run. Outside of a git repository, or
+// before its first commit, there is nothing to record the health under,
+// so the history is only read.
+func WriteHealth(root, notePath string) (*Health, []Regression, error) {
+	h, err := MeasureHealth(root)
+	if err != nil {
+		return nil, nil, err
+	}
+	historyPath := filepath.Join(root, HistoryFile)
+	history, err := LoadHistory(historyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var previous *HistoryEntry
+	if last := history.Last(); last != nil {
+		copied := *last
+		previous = &copied
+	}
+	if commit := gitCommit(root); commit != "" {
+		history.Record(commit, time.Now(), h)
+		data, err := json.MarshalIndent(history, "", "  ")
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := os.WriteFile(historyPath, append(data, '\n'), 0644); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := os.WriteFile(notePath, []byte(HealthMarkdown(h, history, previous)), 0644); err != nil {
+		return nil, nil, err
+	}
+	return h, Regressions(previous, h), nil
+}
@@ -0,0 +1,318 @@
+package doctor
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stampPrefix starts the comment that records what a note was generated
+// from. Being an HTML comment, it doesn't show when the note is rendered.
+const stampPrefix = "<!-- documentor:source "
+
+// NotePath is the note generated for a source file: foo.go gets foo.md
+// next to it.
+func NotePath(sourcePath string) string {
+	return strings.TrimSuffix(sourcePath, filepath.Ext(sourcePath)) + ".md"
+}
+
+// NoteStamp records the source a note was generated from: its name
+// relative to the note, the hash of its content and, for Go, the symbols
+// it declared.
+type NoteStamp struct {
+	Source  string   `json:"source"`
+	Hash    string   `json:"hash"`
+	Symbols []string `json:"symbols,omitempty"`
+}
+
+// NewNoteStamp stamps the source file at sourcePath as it is now.
+func NewNoteStamp(sourcePath string) (*NoteStamp, error) {
+	src, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	return &NoteStamp{
+		Source:  filepath.Base(sourcePath),
+		Hash:    sourceHash(src),
+		Symbols: symbols(sourcePath, src),
+	}, nil
+}
+
+// String renders the stamp as the line ending a note. The source is
+// quoted, as its name may have spaces in it.
+func (s *NoteStamp) String() string {
+	line := stampPrefix + "file=" + strconv.Quote(s.Source) + " hash=" + s.Hash
+	if len(s.Symbols) > 0 {
+		line += " symbols=" + strings.Join(s.Symbols, ",")
+	}
+	return line + " -->\n"
+}
+
+// ReadNoteStamp reads the stamp of the note at notePath, the last one if
+// the note has several. It returns nil if the note has none.
+func ReadNoteStamp(notePath string) (*NoteStamp, error) {
+	note, err := os.Open(notePath)
+	if err != nil {
+		return nil, err
+	}
+	defer note.Close()
+
+	var stamp *NoteStamp
+	scanner := bufio.NewScanner(note)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), stampPrefix)
+		if !ok {
+			continue
+		}
+		stamp = &NoteStamp{}
+		rest = strings.TrimSuffix(rest, "-->")
+		for {
+			var key, value string
+			if key, value, rest = nextStampField(rest); key == "" {
+				break
+			}
+			switch key {
+			case "file":
+				stamp.Source = value
+			case "hash":
+				stamp.Hash = value
+			case "symbols":
+				stamp.Symbols = strings.Split(value, ",")
+			}
+		}
+	}
+	return stamp, scanner.Err()
+}
+
+// nextStampField splits the first key=value field off the fields of a
+// stamp. The value may be quoted; otherwise it ends at the next space.
+// The key is empty when there are no fields left.
+func nextStampField(fields string) (key, value, rest string) {
+	key, rest, ok := strings.Cut(strings.TrimLeft(fields, " "), "=")
+	if !ok {
+		return "", "", ""
+	}
+	if quoted, err := strconv.QuotedPrefix(rest); err == nil {
+		value, _ = strconv.Unquote(quoted)
+		return key, value, rest[len(quoted):]
+	}
+	value, rest, _ = strings.Cut(rest, " ")
+	return key, value, rest
+}
+
+func sourceHash(src []byte) string {
+	sum := sha256.Sum256(src)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// symbols lists the top-level declarations of a Go file, methods as
+// Type.Method, sorted. Other files have none, as do the parts of a Go
+// file that don't parse.
+func symbols(path string, src []byte) []string {
+	if filepath.Ext(path) != ".go" {
+		return nil
+	}
+	file, _ := parser.ParseFile(token.NewFileSet(), path, src, parser.SkipObjectResolution)
+	if file == nil {
+		return nil
+	}
+	var names []string
+	add := func(name string) {
+		if name != "_" {
+			names = append(names, name)
+		}
+	}
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				add(receiverName(decl.Recv.List[0].Type) + "." + decl.Name.Name)
+			} else {
+				add(decl.Name.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					add(spec.Name.Name)
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						add(name.Name)
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NoteStatus says what is wrong with a note.
+type NoteStatus string
+
+// Ways a note can be out of sync
+const (
+	// NoteStale is a note whose source changed since it was generated.
+	// Rover generates it again.
+	NoteStale NoteStatus = "stale"
+	// NoteOrphaned is a note whose source is gone.
+	NoteOrphaned NoteStatus = "orphaned"
+	// NoteMissing is a Go file without a note. Rover generates it.
+	NoteMissing NoteStatus = "missing"
+	// NoteUnmanaged is a note that doesn't record what it was generated
+	// from, such as one written by hand. Whether it is in sync can't be
+	// told, and rover leaves it alone, so it isn't a failure.
+	NoteUnmanaged NoteStatus = "unmanaged"
+)
+
+// Failed reports whether the status is one doctor -notes fails on.
+func (s NoteStatus) Failed() bool {
+	return s != NoteUnmanaged
+}
+
+// NoteProblem is a note out of sync with its source, or one that can't
+// be checked. Stamp is what the note records, if anything; Added and
+// Removed are the symbols the source gained and lost since.
+type NoteProblem struct {
+	Note    string     `json:"note"`
+	Source  string     `json:"source"`
+	Status  NoteStatus `json:"status"`
+	Stamp   *NoteStamp `json:"stamp,omitempty"`
+	Added   []string   `json:"added,omitempty"`
+	Removed []string   `json:"removed,omitempty"`
+}
+
+// String describes the problem on one line.
+func (p *NoteProblem) String() string {
+	switch p.Status {
+	case NoteOrphaned:
+		return fmt.Sprintf("%s: orphaned: its source %s is gone; delete the note", p.Note, p.Source)
+	case NoteMissing:
+		return fmt.Sprintf("%s: missing: %s has no note", p.Note, p.Source)
+	case NoteUnmanaged:
+		return fmt.Sprintf("%s: unmanaged: it doesn't record what it was generated from, so rover leaves it alone; delete it to have rover generate it", p.Note)
+	}
+	msg := fmt.Sprintf("%s: stale: %s changed since the note was generated", p.Note, p.Source)
+	if len(p.Added) > 0 {
+		msg += "; added " + strings.Join(p.Added, ", ")
+	}
+	if len(p.Removed) > 0 {
+		msg += "; removed " + strings.Join(p.Removed, ", ")
+	}
+	return msg
+}
+
+// CheckNote compares the note of the source file at sourcePath with the
+// file. It returns nil if the note is in sync.
+func CheckNote(sourcePath string) (*NoteProblem, error) {
+	notePath := NotePath(sourcePath)
+	p := &NoteProblem{Note: notePath, Source: sourcePath}
+	if _, err := os.Stat(notePath); os.IsNotExist(err) {
+		p.Status = NoteMissing
+		return p, nil
+	}
+	stamp, err := ReadNoteStamp(notePath)
+	if err != nil {
+		return nil, err
+	}
+	if stamp == nil {
+		p.Status = NoteUnmanaged
+		return p, nil
+	}
+	return checkStamp(notePath, stamp)
+}
+
+// checkStamp compares the note at notePath with the source its stamp
+// names. It returns nil if the note is in sync.
+func checkStamp(notePath string, stamp *NoteStamp) (*NoteProblem, error) {
+	sourcePath := filepath.Join(filepath.Dir(notePath), stamp.Source)
+	p := &NoteProblem{Note: notePath, Source: sourcePath, Stamp: stamp}
+	current, err := NewNoteStamp(sourcePath)
+	if os.IsNotExist(err) {
+		p.Status = NoteOrphaned
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if current.Hash == stamp.Hash {
+		return nil, nil
+	}
+	p.Status = NoteStale
+	p.Added = difference(current.Symbols, stamp.Symbols)
+	p.Removed = difference(stamp.Symbols, current.Symbols)
+	return p, nil
+}
+
+// difference lists the elements of a missing from b.
+func difference(a, b []string) []string {
+	var result []string
+	for _, s := range a {
+		if !contains(b, s) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// CheckNotes finds the notes under root that are out of sync: stamped
+// notes whose source, of any kind, changed or is gone, and Go files
+// without a note. It also lists the notes next to a Go file that don't
+// record what they were generated from, as unmanaged. Hidden directories,
+// testdata and vendor are skipped.
+func CheckNotes(root string) ([]*NoteProblem, error) {
+	var problems []*NoteProblem
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if SkipDir(root, path, d) {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+
+		var p *NoteProblem
+		switch filepath.Ext(name) {
+		case ".go":
+			p, err = CheckNote(path)
+			// Stamped notes are checked once, from the note
+			if p != nil && p.Stamp != nil {
+				p = nil
+			}
+		case ".md":
+			stamp, err := ReadNoteStamp(path)
+			if err != nil || stamp == nil {
+				return err
+			}
+			p, err = checkStamp(path, stamp)
+			if err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			problems = append(problems, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return problems, nil
+}
@@ -0,0 +1,277 @@
+package doctor
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Result is the outcome of checking one file: the IDs of the rules that
+// applied to it and what they found.
+type Result struct {
+	File     string    `json:"file"`
+	Rules    []string  `json:"rules"`
+	Findings []Finding `json:"findings"`
+}
+
+// NewResult makes the result of checking the file at filePath, looking
+// up the rules its project enables for it.
+func NewResult(filePath string, findings []Finding) (Result, error) {
+	p, err := findProject(filePath)
+	if err != nil {
+		return Result{}, err
+	}
+	r := Result{File: filepath.ToSlash(filePath), Findings: findings}
+	for _, rule := range p.config.rulesFor(p.rel(filePath), Rules) {
+		r.Rules = append(r.Rules, rule.ID)
+	}
+	return r, nil
+}
+
+// Output formats WriteOutput supports
+const (
+	FormatJSON  = "json"
+	FormatSARIF = "sarif"
+	FormatJUnit = "junit"
+)
+
+// WriteOutput writes results to w in format.
+func WriteOutput(w io.Writer, format string, results []Result) error {
+	switch format {
+	case FormatJSON:
+		return WriteJSON(w, results)
+	case FormatSARIF:
+		return WriteSARIF(w, results)
+	case FormatJUnit:
+		return WriteJUnit(w, results)
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+// WriteJSON writes results as JSON.
+func WriteJSON(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Results []Result `json:"results"`
+	}{results})
+}
+
+// The subset of SARIF 2.1.0 doctor writes
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name  string      `json:"name"`
+		Rules []sarifRule `json:"rules"`
+	}
+	sarifRule struct {
+		ID                   string             `json:"id"`
+		ShortDescription     sarifMessage       `json:"shortDescription"`
+		DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+	}
+	sarifConfiguration struct {
+		Level string `json:"level"`
+	}
+	sarifMessage struct {
+		Text string `json:"text"`
+	}
+	sarifResult struct {
+		RuleID        string          `json:"ruleId"`
+		RuleIndex     int             `json:"ruleIndex"`
+		Level         string          `json:"level"`
+		Message       sarifMessage    `json:"message"`
+		Locations     []sarifLocation `json:"locations"`
+		BaselineState string          `json:"baselineState"`
+		Properties    *sarifFix       `json:"properties,omitempty"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifact `json:"artifactLocation"`
+		Region           sarifRegion   `json:"region"`
+	}
+	sarifArtifact struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn,omitempty"`
+	}
+	sarifFix struct {
+		Fix string `json:"fix"`
+	}
+)
+
+// sarifLevel maps a severity to a SARIF level.
+func sarifLevel(s Severity) string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityInfo:
+		return "note"
+	}
+	return "warning"
+}
+
+// WriteSARIF writes results as a SARIF 2.1.0 log with one run, describing
+// every rule doctor has. Findings in the baseline have the baseline state
+// "unchanged", the others "new".
+func WriteSARIF(w io.Writer, results []Result) error {
+	run := sarifRun{Tool: sarifTool{Driver: sarifDriver{Name: "doctor"}}, Results: []sarifResult{}}
+	index := map[string]int{}
+	for i, rule := range Rules {
+		index[rule.ID] = i
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:                   rule.ID,
+			ShortDescription:     sarifMessage{rule.Description},
+			DefaultConfiguration: sarifConfiguration{sarifLevel(rule.Severity)},
+		})
+	}
+	for _, r := range results {
+		for _, f := range r.Findings {
+			result := sarifResult{
+				RuleID:    f.Rule,
+				RuleIndex: index[f.Rule],
+				Level:     sarifLevel(f.Severity),
+				Message:   sarifMessage{f.Message},
+				Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifact{URI: r.File},
+					Region:           sarifRegion{StartLine: max(f.Position.Line, 1), StartColumn: f.Position.Column},
+				}}},
+				BaselineState: "new",
+			}
+			if f.Baseline {
+				result.BaselineState = "unchanged"
+			}
+			if f.Fix != "" {
+				result.Properties = &sarifFix{f.Fix}
+			}
+			run.Results = append(run.Results, result)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+type (
+	junitSuites struct {
+		XMLName  xml.Name     `xml:"testsuites"`
+		Name     string       `xml:"name,attr"`
+		Tests    int          `xml:"tests,attr"`
+		Failures int          `xml:"failures,attr"`
+		Suites   []junitSuite `xml:"testsuite"`
+	}
+	junitSuite struct {
+		Name     string      `xml:"name,attr"`
+		Tests    int         `xml:"tests,attr"`
+		Failures int         `xml:"failures,attr"`
+		Cases    []junitCase `xml:"testcase"`
+	}
+	junitCase struct {
+		Name      string        `xml:"name,attr"`
+		Classname string        `xml:"classname,attr"`
+		Failure   *junitFailure `xml:"failure,omitempty"`
+		SystemOut string        `xml:"system-out,omitempty"`
+	}
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Type    string `xml:"type,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// WriteJUnit writes results as JUnit XML: a test suite per file with a
+// test case per rule, which fails if the rule found anything new in the
+// file. Findings in the baseline are listed in the test case's output.
+func WriteJUnit(w io.Writer, results []Result) error {
+	suites := junitSuites{Name: "doctor"}
+	for _, r := range results {
+		suite := junitSuite{Name: r.File}
+		byRule := map[string][]Finding{}
+		for _, f := range r.Findings {
+			byRule[f.Rule] = append(byRule[f.Rule], f)
+		}
+		ids := append([]string(nil), r.Rules...)
+		for id := range byRule {
+			if !contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+		sort.Strings(ids)
+
+		for _, id := range ids {
+			c := junitCase{Name: id, Classname: r.File}
+			var fresh, known []string
+			severity := Severity("")
+			for _, f := range byRule[id] {
+				line := fmt.Sprintf("%s:%d:%d: %s", r.File, f.Position.Line, f.Position.Column, f.Message)
+				if f.Baseline {
+					known = append(known, line)
+					continue
+				}
+				fresh = append(fresh, line)
+				if !severity.AtLeast(f.Severity) {
+					severity = f.Severity
+				}
+			}
+			if len(fresh) > 0 {
+				c.Failure = &junitFailure{
+					Message: fmt.Sprintf("%d %s findings", len(fresh), id),
+					Type:    string(severity),
+					Text:    strings.Join(fresh, "\n"),
+				}
+				suite.Failures++
+			}
+			if len(known) > 0 {
+				c.SystemOut = "In the baseline:\n" + strings.Join(known, "\n")
+			}
+			suite.Cases = append(suite.Cases, c)
+		}
+		suite.Tests = len(suite.Cases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package doctor
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// Fix returns the source of in with the fixes of rules applied. The edits
+// come from the AST but are applied to the text, so everything they don't
+// touch keeps its formatting; a file that was gofmt'ed is gofmt'ed again
+// so that, e.g., added imports are sorted.
+func Fix(in *Input, rules []Rule) ([]byte, error) {
+	var edits []Edit
+	for _, rule := range rules {
+		if rule.Fix != nil {
+			edits = append(edits, rule.Fix(in)...)
+		}
+	}
+	if len(edits) == 0 {
+		return in.Source, nil
+	}
+
+	fixed := applyEdits(in.Source, edits)
+	if formatted, err := format.Source(in.Source); err == nil && bytes.Equal(formatted, in.Source) {
+		if formatted, err := format.Source(fixed); err == nil {
+			fixed = formatted
+		}
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), in.Path, fixed, parser.AllErrors); err != nil {
+		return nil, fmt.Errorf("fixing %s produced invalid code: %w", in.Path, err)
+	}
+	return fixed, nil
+}
+
+// applyEdits applies edits to src. Of overlapping edits only the first is
+// applied.
+func applyEdits(src []byte, edits []Edit) []byte {
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].Start < edits[j].Start })
+	var b bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		if e.Start < last {
+			continue
+		}
+		b.Write(src[last:e.Start])
+		b.WriteString(e.New)
+		last = e.End
+	}
+	b.Write(src[last:])
+	return b.Bytes()
+}
+
+// patchContext is the number of unchanged lines around each hunk
+const patchContext = 3
+
+// Patch renders the change from old to new as a unified diff of path. It
+// is empty when nothing changed.
+func Patch(path string, old, new []byte) string {
+	if bytes.Equal(old, new) {
+		return ""
+	}
+	a, b := splitLines(old), splitLines(new)
+	ops := diffLines(a, b)
+
+	var out strings.Builder
+	path = strings.TrimPrefix(path, "/")
+	fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", path, path)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Extend the hunk while changes are closer than twice the context
+		start := max(i-patchContext, 0)
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*patchContext {
+				end = min(end+patchContext, len(ops))
+				break
+			}
+			end = next
+		}
+		writeHunk(&out, ops[start:end])
+		i = end
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, ops []diffOp) {
+	oldStart, newStart := ops[0].oldLine, ops[0].newLine
+	oldCount, newCount := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+	// An empty range starts at the line before it
+	if oldCount == 0 {
+		oldStart--
+	}
+	if newCount == 0 {
+		newStart--
+	}
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, op := range ops {
+		out.WriteByte(op.kind)
+		out.WriteString(op.text)
+		if !strings.HasSuffix(op.text, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// splitLines splits s after each newline.
+func splitLines(s []byte) []string {
+	lines := strings.SplitAfter(string(s), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffOp is a line of a diff: kept (' '), removed ('-') or added ('+').
+// oldLine and newLine are the 1-based lines it is at in either version.
+type diffOp struct {
+	kind             byte
+	text             string
+	oldLine, newLine int
+}
+
+// diffLines computes the shortest edit script from a to b with Myers'
+// algorithm.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	offset := n + m
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace, offset)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the snapshots diffLines took back from the end to
+// recover the edit script.
+func backtrack(a, b []string, trace [][]int, offset int) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{kind: ' ', text: a[x], oldLine: x + 1, newLine: y + 1})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{kind: '+', text: b[y], oldLine: x + 1, newLine: y + 1})
+		} else {
+			x--
+			ops = append(ops, diffOp{kind: '-', text: a[x], oldLine: x + 1, newLine: y + 1})
+		}
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
@@ -0,0 +1,518 @@
+package doctor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+var reliabilityRules = []Rule{
+	{
+		ID:          "RES001",
+		Severity:    SeverityWarning,
+		Description: "A file opened with os.Open or os.Create is never closed",
+		Check:       checkUnclosedFiles,
+	},
+	{
+		ID:          "RES002",
+		Severity:    SeverityWarning,
+		Description: "An HTTP response body is not closed on every path",
+		Check:       checkResponseBodies,
+	},
+	{
+		ID:          "RES003",
+		Severity:    SeverityWarning,
+		Description: "A defer runs inside a loop",
+		Check:       checkDeferInLoops,
+	},
+	{
+		ID:          "NET001",
+		Severity:    SeverityWarning,
+		Description: "An HTTP client has no timeout",
+		Check:       checkClientTimeouts,
+	},
+	{
+		ID:          "ERR002",
+		Severity:    SeverityWarning,
+		Description: "A package other than main exits the program",
+		Check:       checkLibraryExits,
+	},
+}
+
+// opened is a resource assigned to a variable, e.g. f, err := os.Open(…).
+type opened struct {
+	name   string
+	err    string // the error variable, if any
+	call   *ast.CallExpr
+	assign *ast.AssignStmt
+}
+
+// openedIn finds the resources body assigns from calls matching open.
+func openedIn(body *ast.BlockStmt, open func(call *ast.CallExpr) bool) []opened {
+	var resources []opened
+	ast.Inspect(body, func(n ast.Node) bool {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || len(assign.Rhs) != 1 {
+			return true
+		}
+		call, ok := assign.Rhs[0].(*ast.CallExpr)
+		if !ok || !open(call) {
+			return true
+		}
+		ident, ok := assign.Lhs[0].(*ast.Ident)
+		if !ok || ident.Name == "_" {
+			return true
+		}
+		r := opened{name: ident.Name, call: call, assign: assign}
+		if len(assign.Lhs) > 1 {
+			if errIdent, ok := assign.Lhs[1].(*ast.Ident); ok && errIdent.Name != "_" {
+				r.err = errIdent.Name
+			}
+		}
+		resources = append(resources, r)
+		return true
+	})
+	return resources
+}
+
+// funcBodies returns the bodies of the functions declared in file.
+func funcBodies(file *ast.File) []*ast.BlockStmt {
+	var bodies []*ast.BlockStmt
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil {
+			bodies = append(bodies, fn.Body)
+		}
+	}
+	return bodies
+}
+
+// closeCalls returns the calls to closer (e.g. f.Close) in body and
+// whether one of them is deferred.
+func closeCalls(body *ast.BlockStmt, closer string) (calls []*ast.CallExpr, deferred bool) {
+	var inDefer ast.Node
+	ast.Inspect(body, func(n ast.Node) bool {
+		if n == nil {
+			return true
+		}
+		if inDefer != nil && n.Pos() >= inDefer.End() {
+			inDefer = nil
+		}
+		switch n := n.(type) {
+		case *ast.DeferStmt:
+			inDefer = n
+		case *ast.CallExpr:
+			if callName(n.Fun) == closer {
+				calls = append(calls, n)
+				deferred = deferred || inDefer != nil
+			}
+		}
+		return true
+	})
+	return calls, deferred
+}
+
+// escapes reports whether the variable name leaves body: it is returned,
+// stored in a field or composite literal, or sent on a channel. Whoever
+// receives it is then responsible for closing it.
+func escapes(body *ast.BlockStmt, name string) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.ReturnStmt:
+			for _, result := range n.Results {
+				if isIdent(result, name) {
+					found = true
+				}
+			}
+		case *ast.CompositeLit:
+			found = found || mentionsIdent(n, name)
+		case *ast.SendStmt:
+			found = found || isIdent(n.Value, name)
+		case *ast.AssignStmt:
+			for i, rhs := range n.Rhs {
+				if i < len(n.Lhs) && isIdent(rhs, name) {
+					if _, ok := n.Lhs[i].(*ast.Ident); !ok {
+						found = true
+					}
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+func isIdent(e ast.Expr, name string) bool {
+	ident, ok := e.(*ast.Ident)
+	return ok && ident.Name == name
+}
+
+var fileOpeners = map[string]bool{"os.Open": true, "os.Create": true, "os.OpenFile": true}
+
+func checkUnclosedFiles(in *Input) []Finding {
+	_, file := in.AST()
+	if file == nil {
+		return nil
+	}
+	var findings []Finding
+	for _, body := range funcBodies(file) {
+		resources := openedIn(body, func(call *ast.CallExpr) bool { return fileOpeners[callName(call.Fun)] })
+		for _, r := range resources {
+			if calls, _ := closeCalls(body, r.name+".Close"); len(calls) > 0 || escapes(body, r.name) {
+				continue
+			}
+			findings = append(findings, Finding{
+				Message:  fmt.Sprintf("%s from %s is never closed, so the file descriptor leaks", r.name, callName(r.call.Fun)),
+				Position: in.Position(r.call.Pos()),
+				Fix:      fmt.Sprintf("Add `defer %s.Close()` right after checking the error; for files you write, also check the error Close returns.", r.name),
+			})
+		}
+	}
+	return findings
+}
+
+// httpClients recognizes the *http.Client values of a file from what the
+// file itself says about them, since rules see one file without type
+// information: variables, fields and parameters declared as http.Client or
+// *http.Client, and variables assigned a client literal or
+// http.DefaultClient. Clients obtained any other way are not recognized.
+type httpClients struct {
+	http  string // the name net/http is imported as
+	names map[string]bool
+}
+
+func newHTTPClients(file *ast.File) *httpClients {
+	c := &httpClients{names: map[string]bool{}}
+	for name, spec := range imports(file) {
+		if importPath(spec) == "net/http" {
+			c.http = name
+		}
+	}
+	if c.http == "" {
+		return c
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Field:
+			if c.isType(n.Type) {
+				for _, name := range n.Names {
+					c.names[name.Name] = true
+				}
+			}
+		case *ast.ValueSpec:
+			for i, name := range n.Names {
+				if c.isType(n.Type) || i < len(n.Values) && c.isValue(n.Values[i]) {
+					c.names[name.Name] = true
+				}
+			}
+		case *ast.AssignStmt:
+			for i, lhs := range n.Lhs {
+				if name := exprName(lhs); name != "" && i < len(n.Rhs) && c.isValue(n.Rhs[i]) {
+					c.names[name] = true
+				}
+			}
+		}
+		return true
+	})
+	return c
+}
+
+// isType matches http.Client and *http.Client.
+func (c *httpClients) isType(e ast.Expr) bool {
+	if star, ok := e.(*ast.StarExpr); ok {
+		e = star.X
+	}
+	sel, ok := e.(*ast.SelectorExpr)
+	return ok && isIdent(sel.X, c.http) && sel.Sel.Name == "Client"
+}
+
+// isValue matches client literals, http.DefaultClient and the names known
+// to hold clients, including fields such as s.client.
+func (c *httpClients) isValue(e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.UnaryExpr:
+		return e.Op == token.AND && c.isValue(e.X)
+	case *ast.CompositeLit:
+		return c.isType(e.Type)
+	case *ast.SelectorExpr:
+		if isIdent(e.X, c.http) {
+			return e.Sel.Name == "DefaultClient"
+		}
+		return c.names[e.Sel.Name]
+	case *ast.Ident:
+		return c.names[e.Name]
+	}
+	return false
+}
+
+// isResponseCall matches calls that return an *http.Response: the http
+// package helpers, and Do, Get, Post, Head and PostForm on a client.
+func (c *httpClients) isResponseCall(call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || c.http == "" {
+		return false
+	}
+	switch sel.Sel.Name {
+	case "Do", "Get", "Post", "Head", "PostForm":
+	default:
+		return false
+	}
+	if isIdent(sel.X, c.http) {
+		return sel.Sel.Name != "Do"
+	}
+	return c.isValue(sel.X)
+}
+
+func checkResponseBodies(in *Input) []Finding {
+	_, file := in.AST()
+	if file == nil {
+		return nil
+	}
+	var findings []Finding
+	clients := newHTTPClients(file)
+	for _, body := range funcBodies(file) {
+		for _, r := range openedIn(body, clients.isResponseCall) {
+			if escapes(body, r.name) {
+				continue
+			}
+			calls, deferred := closeCalls(body, r.name+".Body.Close")
+			if deferred {
+				continue
+			}
+			fix := fmt.Sprintf("Add `defer %s.Body.Close()` right after checking the error, so the connection is released on every path.", r.name)
+			if len(calls) == 0 {
+				findings = append(findings, Finding{
+					Message:  fmt.Sprintf("%s.Body from %s is never closed, so the connection leaks", r.name, callName(r.call.Fun)),
+					Position: in.Position(r.call.Pos()),
+					Fix:      fix,
+				})
+				continue
+			}
+			if ret := returnBefore(body, r, calls[0].Pos()); ret != nil {
+				findings = append(findings, Finding{
+					Message: fmt.Sprintf("%s.Body from %s is not closed when returning at line %d",
+						r.name, callName(r.call.Fun), in.Position(ret.Pos()).Line),
+					Position: in.Position(r.call.Pos()),
+					Fix:      fix,
+				})
+			}
+		}
+	}
+	return findings
+}
+
+// returnBefore finds a return between r's assignment and pos, other than
+// in the check of r's own error, where there is nothing to close.
+func returnBefore(body *ast.BlockStmt, r opened, pos token.Pos) *ast.ReturnStmt {
+	var found *ast.ReturnStmt
+	checked := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if found != nil || n == nil {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.IfStmt:
+			if !checked && r.err != "" && n.Pos() > r.assign.End() && mentionsIdent(n.Cond, r.err) {
+				checked = true
+				// Skip the error check itself, but not its else branch
+				if n.Else != nil {
+					ast.Inspect(n.Else, func(m ast.Node) bool {
+						if ret, ok := m.(*ast.ReturnStmt); ok && found == nil && ret.Pos() < pos {
+							found = ret
+						}
+						return found == nil
+					})
+				}
+				return false
+			}
+		case *ast.ReturnStmt:
+			if n.Pos() > r.assign.End() && n.Pos() < pos {
+				found = n
+			}
+		}
+		return true
+	})
+	return found
+}
+
+// mentionsIdent reports whether the identifier name occurs anywhere in n.
+func mentionsIdent(n ast.Node, name string) bool {
+	seen := false
+	ast.Inspect(n, func(c ast.Node) bool {
+		if ident, ok := c.(*ast.Ident); ok && ident.Name == name {
+			seen = true
+		}
+		return !seen
+	})
+	return seen
+}
+
+func checkDeferInLoops(in *Input) []Finding {
+	_, file := in.AST()
+	if file == nil {
+		return nil
+	}
+	var findings []Finding
+	var walk func(n ast.Node, loop ast.Node)
+	walk = func(n ast.Node, loop ast.Node) {
+		ast.Inspect(n, func(c ast.Node) bool {
+			switch c := c.(type) {
+			case *ast.FuncLit:
+				// A closure gets its own defer stack
+				walk(c.Body, nil)
+				return false
+			case *ast.ForStmt:
+				walk(c.Body, c)
+				return false
+			case *ast.RangeStmt:
+				walk(c.Body, c)
+				return false
+			case *ast.DeferStmt:
+				if loop != nil {
+					findings = append(findings, Finding{
+						Message: fmt.Sprintf("defer %s inside the loop at line %d only runs when the function returns, so every iteration holds on to its resources until then",
+							callName(c.Call.Fun), in.Position(loop.Pos()).Line),
+						Position: in.Position(c.Pos()),
+						Fix:      "Move the loop body into a function so the deferred call runs at the end of each iteration, or release the resource explicitly.",
+					})
+				}
+			}
+			return true
+		})
+	}
+	for _, body := range funcBodies(file) {
+		walk(body, nil)
+	}
+	return findings
+}
+
+// defaultClientHelpers are the http functions that use http.DefaultClient.
+var defaultClientHelpers = map[string]bool{"Get": true, "Post": true, "Head": true, "PostForm": true}
+
+func checkClientTimeouts(in *Input) []Finding {
+	_, file := in.AST()
+	if file == nil {
+		return nil
+	}
+	clients := newHTTPClients(file)
+	if clients.http == "" {
+		return nil
+	}
+	timed := timedClients(file, clients)
+	const fix = "Use an http.Client with Timeout set (e.g. `&http.Client{Timeout: 30 * time.Second}`), or pass a context with a deadline to each request."
+	var findings []Finding
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CompositeLit:
+			if n.Type == nil || !clients.isType(n.Type) || timed[n] {
+				return true
+			}
+			for _, elt := range n.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok && isIdent(kv.Key, "Timeout") {
+					return true
+				}
+			}
+			findings = append(findings, Finding{
+				Message:  "http.Client has no Timeout, so a slow server can block the request forever",
+				Position: in.Position(n.Pos()),
+				Fix:      fix,
+			})
+		case *ast.SelectorExpr:
+			if isIdent(n.X, clients.http) && n.Sel.Name == "DefaultClient" {
+				findings = append(findings, Finding{
+					Message:  "http.DefaultClient has no timeout, so a slow server can block the request forever",
+					Position: in.Position(n.Pos()),
+					Fix:      fix,
+				})
+				return false
+			}
+		case *ast.CallExpr:
+			if sel, ok := n.Fun.(*ast.SelectorExpr); ok && isIdent(sel.X, clients.http) && defaultClientHelpers[sel.Sel.Name] {
+				findings = append(findings, Finding{
+					Message:  fmt.Sprintf("%s uses http.DefaultClient, which has no timeout", callName(n.Fun)),
+					Position: in.Position(n.Pos()),
+					Fix:      fix,
+				})
+			}
+		}
+		return true
+	})
+	return findings
+}
+
+// timedClients finds the client literals assigned to a name whose Timeout
+// the file sets afterwards, as in `c := &http.Client{}` followed by
+// `c.Timeout = d`. Names are matched as exprName gives them, so a field
+// set as s.client.Timeout covers a literal assigned to client.
+func timedClients(file *ast.File, clients *httpClients) map[*ast.CompositeLit]bool {
+	set := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if assign, ok := n.(*ast.AssignStmt); ok {
+			for _, lhs := range assign.Lhs {
+				if sel, ok := lhs.(*ast.SelectorExpr); ok && sel.Sel.Name == "Timeout" {
+					set[exprName(sel.X)] = true
+				}
+			}
+		}
+		return true
+	})
+
+	timed := map[*ast.CompositeLit]bool{}
+	mark := func(name string, value ast.Expr) {
+		if unary, ok := value.(*ast.UnaryExpr); ok && unary.Op == token.AND {
+			value = unary.X
+		}
+		if lit, ok := value.(*ast.CompositeLit); ok && set[name] && clients.isType(lit.Type) {
+			timed[lit] = true
+		}
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for i, lhs := range n.Lhs {
+				if i < len(n.Rhs) {
+					mark(exprName(lhs), n.Rhs[i])
+				}
+			}
+		case *ast.ValueSpec:
+			for i, name := range n.Names {
+				if i < len(n.Values) {
+					mark(name.Name, n.Values[i])
+				}
+			}
+		case *ast.KeyValueExpr:
+			if key, ok := n.Key.(*ast.Ident); ok {
+				mark(key.Name, n.Value)
+			}
+		}
+		return true
+	})
+	return timed
+}
+
+func checkLibraryExits(in *Input) []Finding {
+	if in.Analysis.PackageName == "main" || strings.HasSuffix(in.Path, "_test.go") {
+		return nil
+	}
+	var findings []Finding
+	for _, call := range in.Analysis.FunctionCalls {
+		if !isExit(call.Name) {
+			continue
+		}
+		decl := enclosing(in.Analysis.Declarations, call.Position)
+		if decl != nil && returnsError(decl) {
+			// Reported by ERR001
+			continue
+		}
+		findings = append(findings, Finding{
+			Message: fmt.Sprintf("%s exits the program from package %s; deferred calls don't run and callers can't recover",
+				call.Name, in.Analysis.PackageName),
+			Position: call.Position,
+			Fix:      "Return an error to the caller and leave exiting to main.",
+		})
+	}
+	return findings
+}
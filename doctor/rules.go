@@ -0,0 +1,123 @@
+package doctor
+
+import (
+	"fmt"
+	"strings"
+
+	"doc/geek"
+)
+
+// Rules are the rules Run applies.
+var Rules = append([]Rule{
+	syntaxRule,
+	fatalInErrorFuncRule,
+	complexityRule,
+	deprecatedRule,
+	suppressionRule,
+}, append(secretRules, reliabilityRules...)...)
+
+var syntaxRule = Rule{
+	ID:          "SYN001",
+	Severity:    SeverityError,
+	Description: "The file has syntax errors",
+	Check: func(in *Input) []Finding {
+		var findings []Finding
+		for _, msg := range in.Analysis.SyntaxErrors {
+			findings = append(findings, Finding{
+				Message:  msg,
+				Position: syntaxErrorPosition(msg, in.Path),
+				Fix:      "Fix the syntax error; until then the analysis of this file is incomplete.",
+			})
+		}
+		return findings
+	},
+}
+
+// syntaxErrorPosition reads the file:line:column prefix of a scanner error.
+func syntaxErrorPosition(msg, path string) geek.Position {
+	pos := geek.Position{File: path}
+	location, _, _ := strings.Cut(msg, ": ")
+	parts := strings.Split(location, ":")
+	if len(parts) >= 3 {
+		fmt.Sscan(parts[len(parts)-2], &pos.Line)
+		fmt.Sscan(parts[len(parts)-1], &pos.Column)
+	}
+	return pos
+}
+
+var fatalInErrorFuncRule = Rule{
+	ID:          "ERR001",
+	Severity:    SeverityWarning,
+	Description: "A function that returns an error exits the program instead",
+	Check: func(in *Input) []Finding {
+		var findings []Finding
+		for _, call := range in.Analysis.FunctionCalls {
+			if !isExit(call.Name) {
+				continue
+			}
+			decl := enclosing(in.Analysis.Declarations, call.Position)
+			if decl == nil || !returnsError(decl) {
+				continue
+			}
+			findings = append(findings, Finding{
+				Message: fmt.Sprintf("%s calls %s although it returns an error; callers never get the chance to handle it",
+					decl.QualifiedName(), call.Name),
+				Position: call.Position,
+				Fix:      "Return the error, wrapped with context if useful, and let the caller decide whether to exit.",
+			})
+		}
+		return findings
+	},
+}
+
+func isExit(callee string) bool {
+	return callee == "os.Exit" || strings.HasPrefix(callee, "log.Fatal")
+}
+
+// enclosing returns the declaration whose body contains pos.
+func enclosing(decls []geek.Declaration, pos geek.Position) *geek.Declaration {
+	for i, decl := range decls {
+		after := pos.Line > decl.Start.Line || (pos.Line == decl.Start.Line && pos.Column >= decl.Start.Column)
+		before := pos.Line < decl.End.Line || (pos.Line == decl.End.Line && pos.Column <= decl.End.Column)
+		if after && before {
+			return &decls[i]
+		}
+	}
+	return nil
+}
+
+func returnsError(decl *geek.Declaration) bool {
+	for _, result := range decl.Results {
+		if result.Type == "error" {
+			return true
+		}
+	}
+	return false
+}
+
+// maxCognitive is the cognitive complexity above which a function is
+// reported
+const maxCognitive = 15
+
+var complexityRule = Rule{
+	ID:          "CPX001",
+	Severity:    SeverityWarning,
+	Description: "A function is hard to follow",
+	Check: func(in *Input) []Finding {
+		if in.Analysis.Metrics == nil {
+			return nil
+		}
+		var findings []Finding
+		for _, fn := range in.Analysis.Metrics.Functions {
+			if fn.Cognitive <= maxCognitive {
+				continue
+			}
+			findings = append(findings, Finding{
+				Message:  fmt.Sprintf("%s has a cognitive complexity of %d (more than %d)", fn.Name, fn.Cognitive, maxCognitive),
+				Position: fn.Position,
+				Fix:      "Extract nested blocks into well-named functions and return early instead of nesting.",
+			})
+		}
+		return findings
+	},
+}
@@ -0,0 +1,553 @@
+package doctor
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"doc/geek"
+)
+
+// AllowlistFile lists secrets doctor should not report. Each line is a
+// fingerprint as shown in the report (sha256:…) or a glob matched against
+// the file path; lines starting with # are comments. Doctor uses the
+// nearest one in the file's directory or its parents.
+const AllowlistFile = ".secrets-allowlist"
+
+var secretRules = []Rule{
+	{
+		ID:          "SEC001",
+		Severity:    SeverityError,
+		Description: "A high-entropy string is assigned to a token, key or secret",
+		Check:       allowed(checkSecretAssignments),
+	},
+	{
+		ID:          "SEC002",
+		Severity:    SeverityError,
+		Description: "A string has the format of a known credential",
+		Check:       allowed(checkKnownFormats),
+	},
+	{
+		ID:          "SEC003",
+		Severity:    SeverityError,
+		Description: "An Authorization header is built from literals",
+		Check:       allowed(checkAuthorizationHeaders),
+	},
+	{
+		ID:          "SEC004",
+		Severity:    SeverityError,
+		Description: "A private key is embedded in the source",
+		Check:       allowed(checkPrivateKeys),
+	},
+}
+
+// secret is a finding together with the value it reveals, which is only
+// used for the fingerprint and never reported.
+type secret struct {
+	Finding
+	value string
+}
+
+const secretFix = "Load the value from the environment or a secret store, and rotate it: it is in the history of the repository."
+
+// allowed turns a secret check into a rule check that drops allowlisted
+// secrets and masks the rest.
+func allowed(check func(in *Input) []secret) func(in *Input) []Finding {
+	return func(in *Input) []Finding {
+		allow := loadAllowlist(filepath.Dir(in.Path))
+		var findings []Finding
+		for _, s := range check(in) {
+			fp := fingerprint(s.value)
+			if allow.allows(in.Path, fp) {
+				continue
+			}
+			s.Message += fmt.Sprintf(" (%s, fingerprint %s)", mask(s.value), fp)
+			if s.Fix == "" {
+				s.Fix = secretFix
+			}
+			findings = append(findings, s.Finding)
+		}
+		return findings
+	}
+}
+
+// mask shows just enough of a secret to recognize it.
+func mask(value string) string {
+	runes := []rune(value)
+	if len(runes) <= 8 {
+		return strings.Repeat("*", len(runes))
+	}
+	return fmt.Sprintf("%s%s, %d chars", string(runes[:4]), strings.Repeat("*", 8), len(runes))
+}
+
+func fingerprint(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+// allowlist is a parsed AllowlistFile; globs are relative to dir.
+type allowlist struct {
+	dir          string
+	fingerprints map[string]bool
+	globs        []string
+}
+
+func (a allowlist) allows(path, fp string) bool {
+	if a.fingerprints[fp] {
+		return true
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(a.dir, abs)
+	if err != nil {
+		return false
+	}
+	for _, glob := range a.globs {
+		if ok, _ := filepath.Match(glob, filepath.ToSlash(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// loadAllowlist reads the nearest allowlist file above dir.
+func loadAllowlist(dir string) allowlist {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return allowlist{}
+	}
+	for {
+		if a, err := readAllowlist(filepath.Join(dir, AllowlistFile)); err == nil {
+			return a
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return allowlist{}
+		}
+		dir = parent
+	}
+}
+
+func readAllowlist(path string) (allowlist, error) {
+	a := allowlist{dir: filepath.Dir(path), fingerprints: map[string]bool{}}
+	file, err := os.Open(path)
+	if err != nil {
+		return a, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "sha256:"):
+			a.fingerprints[line] = true
+		default:
+			a.globs = append(a.globs, line)
+		}
+	}
+	return a, scanner.Err()
+}
+
+// Words and pairs of words that name credentials in identifiers. Words
+// are matched whole, so monkey, keyboard and author don't count.
+var (
+	secretWords = map[string]bool{
+		"token": true, "tokens": true, "secret": true, "secrets": true,
+		"password": true, "passwords": true, "passwd": true, "pwd": true, "passphrase": true,
+		"credential": true, "credentials": true, "apikey": true, "auth": true,
+	}
+	secretPairs = map[[2]string]bool{
+		{"api", "key"}: true, {"access", "key"}: true, {"private", "key"}: true,
+		{"secret", "key"}: true, {"signing", "key"}: true, {"pass", "word"}: true,
+	}
+)
+
+func isSecretName(name string) bool {
+	words := identWords(name)
+	for i, word := range words {
+		if secretWords[word] || i > 0 && secretPairs[[2]string{words[i-1], word}] {
+			return true
+		}
+	}
+	return false
+}
+
+// identWords splits a camelCase, snake_case or kebab-case name into lower
+// case words, keeping acronyms together: APIKey is api, key.
+func identWords(name string) []string {
+	var words []string
+	runes := []rune(name)
+	start := 0
+	flush := func(end int) {
+		if end > start {
+			words = append(words, strings.ToLower(string(runes[start:end])))
+		}
+		start = end
+	}
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || r == '.' || r == ' ':
+			flush(i)
+			start = i + 1
+		case i > start && unicode.IsUpper(r):
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextLower {
+				flush(i)
+			}
+		}
+	}
+	flush(len(runes))
+	return words
+}
+
+// entropy is the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	e := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+// looksRandom matches strings that are long, have no spaces and use many
+// different characters, as generated tokens do.
+func looksRandom(s string) bool {
+	return len(s) >= 16 && !strings.ContainsAny(s, " \t\n") && entropy(s) >= 3.5
+}
+
+func stringValue(e ast.Expr) (string, bool) {
+	lit, ok := e.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+func checkSecretAssignments(in *Input) []secret {
+	_, file := in.AST()
+	if file == nil {
+		return nil
+	}
+	var secrets []secret
+	check := func(name string, value ast.Expr) {
+		s, ok := stringValue(value)
+		if !ok || !isSecretName(name) || !looksRandom(s) {
+			return
+		}
+		secrets = append(secrets, secret{
+			Finding: Finding{
+				Message:  fmt.Sprintf("%s is assigned what looks like a hardcoded credential", name),
+				Position: in.Position(value.Pos()),
+			},
+			value: s,
+		})
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.ValueSpec:
+			for i, name := range node.Names {
+				if i < len(node.Values) {
+					check(name.Name, node.Values[i])
+				}
+			}
+		case *ast.AssignStmt:
+			for i, lhs := range node.Lhs {
+				if i < len(node.Rhs) {
+					if ident := exprName(lhs); ident != "" {
+						check(ident, node.Rhs[i])
+					}
+				}
+			}
+		case *ast.KeyValueExpr:
+			if name := exprName(node.Key); name != "" {
+				check(name, node.Value)
+			} else if key, ok := stringValue(node.Key); ok {
+				check(key, node.Value)
+			}
+		}
+		return true
+	})
+	return secrets
+}
+
+func exprName(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	}
+	return ""
+}
+
+// knownFormats are credential formats recognizable on their own. When a
+// pattern needs context, its first group is the credential.
+var knownFormats = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"AWS access key ID", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"Stripe secret key", regexp.MustCompile(`\b[sr]k_live_[0-9A-Za-z]{24,}\b`)},
+	{"JSON Web Token", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{"Cloudflare account ID", regexp.MustCompile(`api\.cloudflare\.com/client/v4/accounts/([0-9a-f]{32})`)},
+}
+
+func checkKnownFormats(in *Input) []secret {
+	var secrets []secret
+	eachLine(in, func(line int, text string) {
+		for _, format := range knownFormats {
+			for _, match := range format.pattern.FindAllStringSubmatchIndex(text, -1) {
+				start, end := match[0], match[1]
+				// Report just the credential when the pattern has context
+				if len(match) > 2 && match[2] >= 0 {
+					start, end = match[2], match[3]
+				}
+				secrets = append(secrets, secret{
+					Finding: Finding{
+						Message:  fmt.Sprintf("%s in the source", format.name),
+						Position: geek.Position{File: in.Path, Line: line, Column: start + 1},
+					},
+					value: text[start:end],
+				})
+			}
+		}
+	})
+	return secrets
+}
+
+var privateKeyBlock = regexp.MustCompile(`-----BEGIN ((RSA|EC|DSA|OPENSSH|ENCRYPTED|PGP) )?PRIVATE KEY( BLOCK)?-----`)
+
+func checkPrivateKeys(in *Input) []secret {
+	var secrets []secret
+	eachLine(in, func(line int, text string) {
+		if loc := privateKeyBlock.FindStringIndex(text); loc != nil {
+			secrets = append(secrets, secret{
+				Finding: Finding{
+					Message:  "Private key block",
+					Position: geek.Position{File: in.Path, Line: line, Column: loc[0] + 1},
+					Fix:      "Remove the key, revoke it, and load keys from files or a secret store at run time.",
+				},
+				// The header is the same for every key, so fingerprint the line
+				value: strings.TrimSpace(text),
+			})
+		}
+	})
+	return secrets
+}
+
+func eachLine(in *Input, fn func(line int, text string)) {
+	scanner := bufio.NewScanner(strings.NewReader(string(in.Source)))
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		fn(line, scanner.Text())
+	}
+}
+
+func checkAuthorizationHeaders(in *Input) []secret {
+	_, file := in.AST()
+	if file == nil {
+		return nil
+	}
+	var secrets []secret
+	values := newLiterals(file)
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		var value ast.Expr
+		switch sel.Sel.Name {
+		case "Set", "Add":
+			if len(call.Args) != 2 {
+				return true
+			}
+			if name, ok := stringValue(call.Args[0]); !ok || !strings.EqualFold(name, "Authorization") {
+				return true
+			}
+			value = call.Args[1]
+		case "SetBasicAuth":
+			if len(call.Args) != 2 {
+				return true
+			}
+			value = call.Args[1]
+		default:
+			return true
+		}
+		if s, ok := values.value(value); ok && hasCredential(s) {
+			secrets = append(secrets, secret{
+				Finding: Finding{
+					Message:  fmt.Sprintf("%s uses a credential written in the source", callName(call.Fun)),
+					Position: in.Position(call.Pos()),
+				},
+				value: s,
+			})
+		}
+		return true
+	})
+	return secrets
+}
+
+// hasCredential reports whether an Authorization header value or a
+// password holds more than an authentication scheme, such as "Bearer ",
+// which is completed at run time.
+func hasCredential(value string) bool {
+	fields := strings.Fields(value)
+	if len(fields) != 1 {
+		return len(fields) > 1
+	}
+	if strings.HasSuffix(value, " ") {
+		return false
+	}
+	switch strings.ToLower(fields[0]) {
+	case "basic", "bearer", "digest", "token", "negotiate":
+		return false
+	}
+	return true
+}
+
+// literals evaluates expressions built only from string literals and the
+// string constants declared at the top level of a file.
+type literals struct {
+	consts map[string]ast.Expr
+	fmt    string // the name fmt is imported as, if it is
+}
+
+func newLiterals(file *ast.File) *literals {
+	l := &literals{consts: map[string]ast.Expr{}}
+	for name, spec := range imports(file) {
+		if importPath(spec) == "fmt" {
+			l.fmt = name
+		}
+	}
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.ValueSpec)
+			for i, name := range spec.Names {
+				if i < len(spec.Values) {
+					l.consts[name.Name] = spec.Values[i]
+				}
+			}
+		}
+	}
+	return l
+}
+
+// value evaluates e, e.g. "Bearer " + accessToken. Calls of fmt.Sprintf
+// are evaluated when their format only has %s and %v verbs, which print
+// string arguments as they are.
+func (l *literals) value(e ast.Expr) (string, bool) {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		return stringValue(e)
+	case *ast.ParenExpr:
+		return l.value(e.X)
+	case *ast.BinaryExpr:
+		if e.Op != token.ADD {
+			return "", false
+		}
+		x, ok := l.value(e.X)
+		if !ok {
+			return "", false
+		}
+		y, ok := l.value(e.Y)
+		return x + y, ok
+	case *ast.Ident:
+		value, ok := l.consts[e.Name]
+		if !ok {
+			return "", false
+		}
+		// Guard against evaluating a constant in terms of itself
+		delete(l.consts, e.Name)
+		defer func() { l.consts[e.Name] = value }()
+		return l.value(value)
+	case *ast.CallExpr:
+		fun, ok := e.Fun.(*ast.SelectorExpr)
+		if !ok || fun.Sel.Name != "Sprintf" || len(e.Args) == 0 || l.fmt == "" || !isIdent(fun.X, l.fmt) {
+			return "", false
+		}
+		var args []string
+		for _, arg := range e.Args {
+			s, ok := l.value(arg)
+			if !ok {
+				return "", false
+			}
+			args = append(args, s)
+		}
+		return sprintStrings(args[0], args[1:])
+	}
+	return "", false
+}
+
+// sprintStrings formats string arguments with a format whose verbs are
+// all %s or %v, and gives up on any other format.
+func sprintStrings(format string, args []string) (string, bool) {
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+		if i++; i == len(format) {
+			return "", false
+		}
+		switch format[i] {
+		case '%':
+			b.WriteByte('%')
+		case 's', 'v':
+			if n == len(args) {
+				return "", false
+			}
+			b.WriteString(args[n])
+			n++
+		default:
+			return "", false
+		}
+	}
+	return b.String(), n == len(args)
+}
+
+// callName renders a call's function expression, e.g. req.Header.Set.
+func callName(fun ast.Expr) string {
+	switch f := fun.(type) {
+	case *ast.Ident:
+		return f.Name
+	case *ast.SelectorExpr:
+		return callName(f.X) + "." + f.Sel.Name
+	}
+	return "call"
+}
@@ -0,0 +1,112 @@
+package doctor
+
+import (
+	"fmt"
+	"go/ast"
+	"path"
+	"strings"
+
+	"doc/geek"
+)
+
+// ignoreDirective suppresses findings: //documentor:ignore RULE-ID reason
+// silences the rule (or rules, comma-separated; IDs may be patterns) on
+// its own line, or on the next line when the comment stands alone.
+const ignoreDirective = "//documentor:ignore"
+
+// suppression is a parsed ignore directive.
+type suppression struct {
+	rules    []string
+	reason   string
+	line     int // the line the directive covers
+	position geek.Position
+}
+
+func (s suppression) covers(f Finding) bool {
+	if f.Position.Line != s.line {
+		return false
+	}
+	for _, rule := range s.rules {
+		if ok, _ := path.Match(rule, f.Rule); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// suppressions reads the ignore directives of in. They are taken from the
+// comments of the AST, so a string containing the directive doesn't
+// count; a file that doesn't parse has none.
+func suppressions(in *Input) []suppression {
+	fset, file := in.AST()
+	if file == nil {
+		return nil
+	}
+	var result []suppression
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			rest, ok := strings.CutPrefix(c.Text, ignoreDirective)
+			if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+				continue
+			}
+			fields := strings.Fields(rest)
+			s := suppression{position: in.Position(c.Pos())}
+			if len(fields) > 0 {
+				s.rules = strings.Split(fields[0], ",")
+				s.reason = strings.Join(fields[1:], " ")
+			}
+			s.line = s.position.Line
+			if standsAlone(in, c) {
+				s.line = fset.Position(c.End()).Line + 1
+			}
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// standsAlone reports whether c is the only thing on its line.
+func standsAlone(in *Input, c *ast.Comment) bool {
+	offset := in.Offset(c.Pos())
+	return strings.TrimSpace(string(in.Source[lineStart(in.Source, offset):offset])) == ""
+}
+
+var suppressionRule = Rule{
+	ID:          "SUP001",
+	Severity:    SeverityWarning,
+	Description: "An ignore directive names no rule or gives no reason",
+	Check: func(in *Input) []Finding {
+		var findings []Finding
+		for _, s := range suppressions(in) {
+			if len(s.rules) > 0 && s.reason != "" {
+				continue
+			}
+			findings = append(findings, Finding{
+				Message:  fmt.Sprintf("%s needs a rule ID and a reason, e.g. %s ERR001 exiting is intended here", ignoreDirective, ignoreDirective),
+				Position: s.position,
+				Fix:      "Say which rule is silenced and why, so the next reader doesn't have to guess.",
+			})
+		}
+		return findings
+	},
+}
+
+// suppress drops the findings an ignore directive covers. A directive
+// without a reason still applies; SUP001 reports it.
+func suppress(in *Input, findings []Finding) []Finding {
+	directives := suppressions(in)
+	var kept []Finding
+	for _, f := range findings {
+		suppressed := false
+		for _, s := range directives {
+			if s.covers(f) {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
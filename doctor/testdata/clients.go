@@ -0,0 +1,19 @@
+package clients
+
+import (
+	nethttp "net/http"
+
+	http "example.com/fake/http"
+)
+
+var client = &nethttp.Client{}
+
+func Fetch(u string) (*nethttp.Response, error) {
+	return nethttp.Get(u)
+}
+
+// The package of this module named http is not net/http
+func Local(u string) error {
+	c := &http.Client{}
+	return http.Get(c, u)
+}
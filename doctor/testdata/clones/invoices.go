@@ -0,0 +1,29 @@
+package shop
+
+import "strings"
+
+type Invoice struct {
+	Number string
+	Lines  []string
+	Amount float64
+}
+
+func Totals(invoices []Invoice) map[string]float64 {
+	sums := map[string]float64{}
+	for _, invoice := range invoices {
+		if len(invoice.Lines) == 0 {
+			continue
+		}
+		invoice.Amount *= 1.2
+		number := strings.ToUpper(invoice.Number)
+		sums[number] += invoice.Amount
+		if sums[number] > 500 {
+			sums[number] = 500
+		}
+	}
+	return sums
+}
+
+func Unrelated(s string) int {
+	return len(s) * 2
+}
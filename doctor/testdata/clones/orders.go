@@ -0,0 +1,24 @@
+package shop
+
+import "strings"
+
+type Order struct {
+	ID    string
+	Items []string
+	Total float64
+}
+
+func Summarize(orders []Order) map[string]float64 {
+	totals := map[string]float64{}
+	for _, order := range orders {
+		if len(order.Items) == 0 {
+			continue
+		}
+		key := strings.ToLower(order.ID)
+		totals[key] += order.Total
+		if totals[key] > 1000 {
+			totals[key] = 1000
+		}
+	}
+	return totals
+}
@@ -0,0 +1,22 @@
+package files
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+func Load(path string) ([]byte, error) {
+	return ioutil.ReadFile(path)
+}
+
+func Tail(f *os.File) ([]byte, error) {
+	if _, err := f.Seek(-64, os.SEEK_END); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(f)
+}
+
+func List(dir string) (int, error) {
+	infos, err := ioutil.ReadDir(dir)
+	return len(infos), err
+}
@@ -0,0 +1,43 @@
+// Package docs is documented.
+package docs
+
+// Client talks to the server.
+type Client struct{}
+
+// Get fetches a page.
+func (c *Client) Get() {}
+
+// Post is documented for the wrong name.
+func (c *Client) Put() {}
+
+func (c *Client) unexported() {}
+
+type Server struct{}
+
+// A Handler serves requests.
+type Handler interface{}
+
+// Modes of a Client
+const (
+	Read = iota
+	Write
+)
+
+var (
+	// Timeout bounds requests.
+	Timeout = 10
+	Retries = 3
+)
+
+// MaxSize limits uploads.
+const MaxSize = 1 << 20
+
+var Debug bool
+
+// New returns a Client.
+func New() *Client { return &Client{} }
+
+// Newer is not about NewServer.
+func NewServer() *Server { return &Server{} }
+
+func helper() {}
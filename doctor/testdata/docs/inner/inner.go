@@ -0,0 +1,4 @@
+package inner
+
+// Exported is documented.
+func Exported() {}
@@ -0,0 +1,20 @@
+package fetch
+
+import (
+	"log"
+	"net/http"
+)
+
+func Fetch(url string) (*http.Response, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		log.Fatalf("fetch %s: %v", url, err)
+	}
+	return resp, nil
+}
+
+func Check() {
+	if _, err := Fetch("https://example.com"); err != nil {
+		log.Fatal(err)
+	}
+}
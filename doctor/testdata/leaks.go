@@ -0,0 +1,106 @@
+package leaks
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+func Read(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(f)
+}
+
+func Create(path string) (*os.File, error) {
+	return os.Create(path)
+}
+
+var client = &http.Client{}
+
+func Status(url string) (int, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func Body(url string) ([]byte, error) {
+	c := http.Client{Timeout: 10 * time.Second}
+	resp, err := c.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func Ping(url string) error {
+	resp, err := http.DefaultClient.Head(url)
+	if err != nil {
+		return err
+	}
+	_ = resp
+	return nil
+}
+
+func Copy(paths []string, w io.Writer) error {
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		go func() {
+			defer w.Write(nil)
+		}()
+		if _, err := io.Copy(w, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func Must(err error) {
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+type Service struct {
+	api *http.Client
+}
+
+func (s *Service) Send(req *http.Request) (int, error) {
+	resp, err := s.api.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	return resp.StatusCode, nil
+}
+
+type cache struct{}
+
+func (cache) Get(key string) (string, error) { return key, nil }
+
+func Lookup(cacheClient cache) string {
+	value, err := cacheClient.Get("key")
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+func Timed() *http.Client {
+	c := &http.Client{}
+	c.Timeout = 10 * time.Second
+	return c
+}
@@ -0,0 +1,16 @@
+package noise
+
+import "os"
+
+func Stop() {
+	os.Exit(1) //documentor:ignore ERR002 the CLI wrapper owns this package
+}
+
+func Halt() {
+	//documentor:ignore ERR002
+	os.Exit(2)
+}
+
+func Quit() {
+	os.Exit(3)
+}
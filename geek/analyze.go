@@ -0,0 +1,320 @@
+package geek
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// analyzeFile walks a parsed file and fills every AnalysisResult category.
+// Positions are reported against filename rather than the name the file was
+// parsed with, so callers can use paths relative to wherever notes live.
+func analyzeFile(fset *token.FileSet, file *ast.File, filename string) AnalysisResult {
+	var (
+		imports         []Item
+		structs         []Item
+		variables       []Item
+		constants       []Item
+		comments        []Comment
+		interfaces      []Item
+		methods         []Item
+		channels        []Item
+		errorHandling   []Assignment
+		typeAssertions  []Item
+		controlFlow     []Item
+		deferStatements []Item
+		panicRecover    []Item
+		functionCalls   []Item
+		declarations    []Declaration
+	)
+	at := func(pos token.Pos) Position {
+		return position(fset, pos, filename)
+	}
+	item := func(name string, pos token.Pos) Item {
+		return Item{Name: name, Position: at(pos)}
+	}
+
+	// Check for imports, grouped or not
+	for _, spec := range file.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err == nil {
+			imports = append(imports, item(path, spec.Path.Pos()))
+		}
+	}
+
+	// Check for comments, leaving out directives and commented-out code
+	for _, group := range file.Comments {
+		if text := commentText(group); text != "" {
+			comments = append(comments, Comment{Text: text, Position: at(group.Pos())})
+		}
+	}
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.GenDecl:
+			for _, spec := range node.Specs {
+				switch spec := spec.(type) {
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						if name.Name == "_" {
+							continue
+						}
+						if node.Tok == token.CONST {
+							constants = append(constants, item(name.Name, name.Pos()))
+						} else {
+							variables = append(variables, item(name.Name, name.Pos()))
+						}
+					}
+				case *ast.TypeSpec:
+					switch spec.Type.(type) {
+					case *ast.StructType:
+						structs = append(structs, item(spec.Name.Name, spec.Name.Pos()))
+					case *ast.InterfaceType:
+						interfaces = append(interfaces, item(spec.Name.Name, spec.Name.Pos()))
+					}
+				}
+			}
+
+		case *ast.FuncDecl:
+			decl := declaration(fset, node, filename)
+			if decl.Receiver != "" {
+				methods = append(methods, item(decl.QualifiedName(), node.Name.Pos()))
+			}
+			declarations = append(declarations, decl)
+
+		case *ast.ChanType:
+			channels = append(channels, item(types.ExprString(node), node.Pos()))
+
+		case *ast.AssignStmt:
+			// Multi-value assignments from a single call, e.g. `x, err := f()`
+			if len(node.Lhs) > 1 && len(node.Rhs) == 1 {
+				if call, ok := node.Rhs[0].(*ast.CallExpr); ok {
+					assignment := Assignment{Call: calleeName(call), Position: at(node.Pos())}
+					for _, lhs := range node.Lhs {
+						assignment.Targets = append(assignment.Targets, types.ExprString(lhs))
+					}
+					errorHandling = append(errorHandling, assignment)
+				}
+			}
+
+		case *ast.TypeAssertExpr:
+			if node.Type != nil {
+				typeAssertions = append(typeAssertions, item(types.ExprString(node), node.Pos()))
+			}
+
+		case *ast.IfStmt:
+			controlFlow = append(controlFlow, item("if", node.Pos()))
+			if node.Else != nil {
+				controlFlow = append(controlFlow, item("else", node.Else.Pos()))
+			}
+		case *ast.ForStmt:
+			controlFlow = append(controlFlow, item("for", node.Pos()))
+		case *ast.RangeStmt:
+			controlFlow = append(controlFlow, item("range", node.Pos()))
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt:
+			controlFlow = append(controlFlow, item("switch", node.Pos()))
+		case *ast.SelectStmt:
+			controlFlow = append(controlFlow, item("select", node.Pos()))
+		case *ast.CaseClause:
+			if node.List == nil {
+				controlFlow = append(controlFlow, item("default", node.Pos()))
+			} else {
+				controlFlow = append(controlFlow, item("case", node.Pos()))
+			}
+		case *ast.CommClause:
+			if node.Comm == nil {
+				controlFlow = append(controlFlow, item("default", node.Pos()))
+			} else {
+				controlFlow = append(controlFlow, item("case", node.Pos()))
+			}
+
+		case *ast.DeferStmt:
+			deferStatements = append(deferStatements, item(calleeName(node.Call), node.Pos()))
+
+		case *ast.CallExpr:
+			name := calleeName(node)
+			if name == "panic" || name == "recover" {
+				panicRecover = append(panicRecover, item(name, node.Pos()))
+			}
+			functionCalls = append(functionCalls, item(name, node.Pos()))
+		}
+		return true
+	})
+
+	result := AnalysisResult{
+		SchemaVersion:   SchemaVersion,
+		PackageName:     file.Name.Name,
+		Imports:         removeDuplicates(imports),
+		Structs:         removeDuplicates(structs),
+		Variables:       removeDuplicates(variables),
+		Constants:       removeDuplicates(constants),
+		Comments:        removeDuplicates(comments),
+		Interfaces:      removeDuplicates(interfaces),
+		Methods:         removeDuplicates(methods),
+		Channels:        removeDuplicates(channels),
+		ErrorHandling:   append([]Assignment{}, errorHandling...),
+		TypeAssertions:  removeDuplicates(typeAssertions),
+		ControlFlow:     removeDuplicates(controlFlow),
+		DeferStatements: removeDuplicates(deferStatements),
+		PanicRecover:    removeDuplicates(panicRecover),
+		FunctionCalls:   removeDuplicates(functionCalls),
+		Declarations:    append([]Declaration{}, declarations...),
+	}
+	if c := analyzeConcurrency(file, at); !c.Empty() {
+		result.Concurrency = c
+	}
+	result.Metrics = computeMetrics(file, at)
+	return result
+}
+
+// declaration builds the structured description of a function or method.
+func declaration(fset *token.FileSet, fn *ast.FuncDecl, filename string) Declaration {
+	decl := Declaration{
+		Name:     fn.Name.Name,
+		Params:   params(fn.Type.Params),
+		Results:  params(fn.Type.Results),
+		Exported: fn.Name.IsExported(),
+		Doc:      strings.TrimSpace(fn.Doc.Text()),
+		Start:    position(fset, fn.Pos(), filename),
+		End:      position(fset, fn.End(), filename),
+	}
+	if fn.Recv != nil && len(fn.Recv.List) > 0 {
+		recv := fn.Recv.List[0].Type
+		if star, ok := recv.(*ast.StarExpr); ok {
+			decl.PointerReceiver = true
+			recv = star.X
+		}
+		decl.Receiver = receiverTypeName(recv)
+	}
+	decl.TypeParams = params(fn.Type.TypeParams)
+	if len(decl.TypeParams) == 0 {
+		decl.TypeParams = nil
+	}
+	return decl
+}
+
+// params flattens a field list so that "a, b int" becomes two entries.
+func params(fields *ast.FieldList) []Param {
+	result := []Param{}
+	if fields == nil {
+		return result
+	}
+	for _, field := range fields.List {
+		typ := types.ExprString(field.Type)
+		if len(field.Names) == 0 {
+			result = append(result, Param{Type: typ})
+			continue
+		}
+		for _, name := range field.Names {
+			result = append(result, Param{Name: name.Name, Type: typ})
+		}
+	}
+	return result
+}
+
+func position(fset *token.FileSet, pos token.Pos, filename string) Position {
+	p := fset.Position(pos)
+	return Position{File: filename, Line: p.Line, Column: p.Column}
+}
+
+// calleeName renders the function part of a call, e.g. "fmt.Println".
+func calleeName(call *ast.CallExpr) string {
+	if _, ok := call.Fun.(*ast.FuncLit); ok {
+		return "func literal"
+	}
+	return types.ExprString(call.Fun)
+}
+
+// receiverTypeName strips pointers and type parameters from a receiver type.
+func receiverTypeName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return types.ExprString(expr)
+		}
+	}
+}
+
+// commentText returns the text of a comment group, or "" when the group is
+// a compiler directive or mostly commented-out code.
+func commentText(group *ast.CommentGroup) string {
+	text := strings.TrimSpace(group.Text())
+	if text == "" {
+		return ""
+	}
+
+	code, prose := 0, 0
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if isCodeLine(line) {
+			code++
+		} else {
+			prose++
+		}
+	}
+	if code > prose {
+		return ""
+	}
+	return text
+}
+
+var goKeywords = []string{
+	"func ", "return", "if ", "for ", "switch ", "select ", "case ", "go ",
+	"defer ", "var ", "const ", "type ", "import ", "package ", "break", "continue",
+}
+
+// isCodeLine guesses whether a single comment line is Go source rather than prose.
+func isCodeLine(line string) bool {
+	switch line {
+	case "{", "}", ")", "})", "},", "),":
+		return true
+	}
+
+	// Prose rarely ends with a brace or contains Go-only punctuation
+	if strings.HasSuffix(line, "{") || strings.HasSuffix(line, "}") ||
+		strings.Contains(line, ":=") || strings.Contains(line, "!=") ||
+		strings.Contains(line, "==") || strings.Contains(line, "&&") ||
+		strings.Contains(line, "||") {
+		return true
+	}
+
+	// Anything else counts as code only if it parses and looks like code
+	if !strings.ContainsAny(line, "()[]=\"`") {
+		startsWithKeyword := false
+		for _, kw := range goKeywords {
+			if strings.HasPrefix(line, kw) {
+				startsWithKeyword = true
+				break
+			}
+		}
+		if !startsWithKeyword {
+			return false
+		}
+	}
+	return parses(line)
+}
+
+// parses reports whether line is a valid Go statement or declaration.
+func parses(line string) bool {
+	fset := token.NewFileSet()
+	if _, err := parser.ParseFile(fset, "", "package p\nfunc _() {\n"+line+"\n}", 0); err == nil {
+		return true
+	}
+	_, err := parser.ParseFile(fset, "", "package p\n"+line+"\n", 0)
+	return err == nil
+}
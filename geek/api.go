@@ -0,0 +1,500 @@
+package geek
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Symbol kinds of an API
+const (
+	SymbolConst           = "const"
+	SymbolVar             = "var"
+	SymbolType            = "type"
+	SymbolField           = "field"
+	SymbolFunc            = "func"
+	SymbolMethod          = "method"
+	SymbolInterfaceMethod = "interface-method"
+)
+
+// Symbol is one exported identifier of a package. Name is unique within
+// the package and kind: fields and interface methods are named Type.Name,
+// methods (T).Name or (*T).Name. Signature never includes parameter names,
+// so renaming a parameter doesn't change the API.
+type Symbol struct {
+	Package   string `json:"package"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Signature string `json:"signature"`
+	Value     string `json:"value,omitempty"`
+}
+
+// Line renders the symbol in the text snapshot format, e.g.
+//
+//	pkg doc/geek, func Analyze func(string, Options) (*AnalysisResult, error)
+func (s Symbol) Line() string {
+	line := fmt.Sprintf("pkg %s, %s %s %s", s.Package, s.Kind, s.Name, s.Signature)
+	if s.Value != "" {
+		line += " = " + s.Value
+	}
+	return line
+}
+
+func (s Symbol) key() string {
+	return s.Package + " " + s.Kind + " " + s.Name
+}
+
+// API is the exported API of a module, sorted so snapshots are stable.
+type API struct {
+	Module  string   `json:"module"`
+	Symbols []Symbol `json:"symbols"`
+}
+
+// ExtractAPI type-checks the module containing dir and lists the exported
+// API of its importable packages: main and internal packages are skipped.
+func ExtractAPI(dir string) (*API, error) {
+	l, err := newLoader(dir)
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := l.loadAll(l.root)
+	if err != nil {
+		return nil, err
+	}
+
+	api := &API{Module: l.mod.Module, Symbols: []Symbol{}}
+	for _, pkg := range pkgs {
+		if pkg.Types.Name() == "main" || isInternal(pkg.Path) {
+			continue
+		}
+		api.Symbols = append(api.Symbols, packageSymbols(pkg.Types)...)
+	}
+	api.sort()
+	return api, nil
+}
+
+func isInternal(path string) bool {
+	for _, elem := range strings.Split(path, "/") {
+		if elem == "internal" {
+			return true
+		}
+	}
+	return false
+}
+
+func (api *API) sort() {
+	sort.Slice(api.Symbols, func(i, j int) bool {
+		return api.Symbols[i].Line() < api.Symbols[j].Line()
+	})
+}
+
+// packageSymbols lists the exported symbols of pkg.
+func packageSymbols(pkg *types.Package) []Symbol {
+	qualifier := func(p *types.Package) string {
+		if p == pkg {
+			return ""
+		}
+		return p.Name()
+	}
+	var symbols []Symbol
+	add := func(kind, name, signature string) {
+		symbols = append(symbols, Symbol{Package: pkg.Path(), Kind: kind, Name: name, Signature: signature})
+	}
+
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		switch obj := obj.(type) {
+		case *types.Const:
+			symbols = append(symbols, Symbol{
+				Package:   pkg.Path(),
+				Kind:      SymbolConst,
+				Name:      name,
+				Signature: types.TypeString(obj.Type(), qualifier),
+				Value:     obj.Val().ExactString(),
+			})
+		case *types.Var:
+			add(SymbolVar, name, types.TypeString(obj.Type(), qualifier))
+		case *types.Func:
+			add(SymbolFunc, name, signatureString(obj.Type().(*types.Signature), qualifier))
+		case *types.TypeName:
+			symbols = append(symbols, typeSymbols(pkg, obj, qualifier)...)
+		}
+	}
+	return symbols
+}
+
+// typeSymbols lists a type with its exported fields and methods.
+func typeSymbols(pkg *types.Package, tn *types.TypeName, qualifier types.Qualifier) []Symbol {
+	name := tn.Name()
+	symbol := func(kind, name, signature string) Symbol {
+		return Symbol{Package: pkg.Path(), Kind: kind, Name: name, Signature: signature}
+	}
+
+	var underlying string
+	switch u := tn.Type().Underlying().(type) {
+	case *types.Struct:
+		underlying = "struct"
+	case *types.Interface:
+		underlying = "interface"
+	default:
+		underlying = types.TypeString(u, qualifier)
+	}
+	if tn.IsAlias() {
+		return []Symbol{symbol(SymbolType, name, "= "+types.TypeString(tn.Type(), qualifier))}
+	}
+	named, ok := tn.Type().(*types.Named)
+	if !ok {
+		return nil
+	}
+	if tparams := named.TypeParams(); tparams.Len() > 0 {
+		underlying = typeParamsString(tparams, qualifier) + " " + underlying
+	}
+	symbols := []Symbol{symbol(SymbolType, name, underlying)}
+
+	switch u := named.Underlying().(type) {
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			field := u.Field(i)
+			if field.Exported() {
+				symbols = append(symbols, symbol(SymbolField, name+"."+field.Name(), types.TypeString(field.Type(), qualifier)))
+			}
+		}
+	case *types.Interface:
+		for i := 0; i < u.NumMethods(); i++ {
+			method := u.Method(i)
+			if method.Exported() {
+				symbols = append(symbols, symbol(SymbolInterfaceMethod, name+"."+method.Name(),
+					signatureString(method.Type().(*types.Signature), qualifier)))
+			}
+		}
+		return symbols
+	}
+
+	for i := 0; i < named.NumMethods(); i++ {
+		method := named.Method(i)
+		if !method.Exported() {
+			continue
+		}
+		recv := name
+		if _, ok := method.Type().(*types.Signature).Recv().Type().(*types.Pointer); ok {
+			recv = "*" + name
+		}
+		symbols = append(symbols, symbol(SymbolMethod, "("+recv+")."+method.Name(),
+			signatureString(method.Type().(*types.Signature), qualifier)))
+	}
+	return symbols
+}
+
+// signatureString renders sig without parameter names, e.g.
+// func(string, ...int) (bool, error).
+func signatureString(sig *types.Signature, qualifier types.Qualifier) string {
+	var b strings.Builder
+	b.WriteString("func")
+	if tparams := sig.TypeParams(); tparams.Len() > 0 {
+		b.WriteString(typeParamsString(tparams, qualifier))
+	}
+
+	b.WriteByte('(')
+	params := sig.Params()
+	for i := 0; i < params.Len(); i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		t := params.At(i).Type()
+		if sig.Variadic() && i == params.Len()-1 {
+			b.WriteString("..." + types.TypeString(t.(*types.Slice).Elem(), qualifier))
+			continue
+		}
+		b.WriteString(types.TypeString(t, qualifier))
+	}
+	b.WriteByte(')')
+
+	results := sig.Results()
+	switch results.Len() {
+	case 0:
+	case 1:
+		b.WriteString(" " + types.TypeString(results.At(0).Type(), qualifier))
+	default:
+		b.WriteString(" (")
+		for i := 0; i < results.Len(); i++ {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(types.TypeString(results.At(i).Type(), qualifier))
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+func typeParamsString(tparams *types.TypeParamList, qualifier types.Qualifier) string {
+	var parts []string
+	for i := 0; i < tparams.Len(); i++ {
+		tp := tparams.At(i)
+		parts = append(parts, tp.Obj().Name()+" "+types.TypeString(tp.Constraint(), qualifier))
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// Text renders the snapshot as one line per symbol.
+func (api *API) Text() string {
+	var b strings.Builder
+	for _, s := range api.Symbols {
+		b.WriteString(s.Line() + "\n")
+	}
+	return b.String()
+}
+
+// WriteAPI writes the snapshot to path, as JSON if the name ends in .json
+// and as text otherwise.
+func WriteAPI(api *API, path string) error {
+	if filepath.Ext(path) != ".json" {
+		return os.WriteFile(path, []byte(api.Text()), 0644)
+	}
+	data, err := json.MarshalIndent(api, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// LoadAPI reads a snapshot written by WriteAPI.
+func LoadAPI(path string) (*API, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) == ".json" {
+		var api API
+		if err := json.Unmarshal(data, &api); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return &api, nil
+	}
+	api, err := ParseAPI(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return api, nil
+}
+
+// ParseAPI reads a text snapshot.
+func ParseAPI(r io.Reader) (*API, error) {
+	api := &API{Symbols: []Symbol{}}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		rest, ok := strings.CutPrefix(text, "pkg ")
+		pkg, rest, found := strings.Cut(rest, ", ")
+		fields := strings.SplitN(rest, " ", 3)
+		if !ok || !found || len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: malformed symbol %q", line, text)
+		}
+		s := Symbol{Package: pkg, Kind: fields[0], Name: fields[1], Signature: fields[2]}
+		if s.Kind == SymbolConst {
+			s.Signature, s.Value, _ = strings.Cut(s.Signature, " = ")
+		}
+		api.Symbols = append(api.Symbols, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return api, nil
+}
+
+// APIAtRevision extracts the API of the module containing dir as it was
+// at a git revision of the local repository.
+func APIAtRevision(dir, rev string) (*API, error) {
+	git := func(args ...string) (string, error) {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), bytes.TrimSpace(exitErr.Stderr))
+			}
+			return "", err
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	prefix, err := git("rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := git("rev-parse", "--verify", rev+"^{commit}"); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp("", "geek-api-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	cmd := exec.Command("git", "-C", dir, "archive", "--format=tar", rev)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	archive, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	extractErr := extractTar(archive, tmp)
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("git archive %s: %s", rev, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if extractErr != nil {
+		return nil, extractErr
+	}
+	return ExtractAPI(filepath.Join(tmp, filepath.FromSlash(prefix)))
+}
+
+// extractTar writes the regular files of a tar archive under dir.
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		path := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return fmt.Errorf("archive entry %q escapes %s", header.Name, dir)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return err
+		}
+	}
+}
+
+// Change kinds of an API diff
+const (
+	ChangeAddition   = "addition"
+	ChangeCompatible = "compatible"
+	ChangeBreaking   = "breaking"
+)
+
+// APIChange is a symbol that differs between two snapshots. Old is empty
+// for additions and New for removals.
+type APIChange struct {
+	Kind   string `json:"kind"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// APIDiff classifies the changes from one snapshot to another.
+type APIDiff struct {
+	Additions  []APIChange `json:"additions"`
+	Compatible []APIChange `json:"compatible"`
+	Breaking   []APIChange `json:"breaking"`
+}
+
+// DiffAPI compares two snapshots. Removals and changed signatures break
+// callers; so do new methods on an existing interface, which break its
+// implementations. Changed constant values are reported as compatible.
+func DiffAPI(from, to *API) *APIDiff {
+	diff := &APIDiff{Additions: []APIChange{}, Compatible: []APIChange{}, Breaking: []APIChange{}}
+	before := map[string]Symbol{}
+	for _, s := range from.Symbols {
+		before[s.key()] = s
+	}
+	after := map[string]Symbol{}
+	for _, s := range to.Symbols {
+		after[s.key()] = s
+	}
+
+	for _, s := range from.Symbols {
+		if _, ok := after[s.key()]; !ok {
+			diff.Breaking = append(diff.Breaking, APIChange{Kind: ChangeBreaking, Old: s.Line(), Reason: "removed"})
+		}
+	}
+	for _, s := range to.Symbols {
+		prev, existed := before[s.key()]
+		switch {
+		case !existed && s.Kind == SymbolInterfaceMethod && interfaceExisted(before, s):
+			diff.Breaking = append(diff.Breaking, APIChange{Kind: ChangeBreaking, New: s.Line(),
+				Reason: "method added to an interface; existing implementations no longer satisfy it"})
+		case !existed:
+			diff.Additions = append(diff.Additions, APIChange{Kind: ChangeAddition, New: s.Line(), Reason: "added"})
+		case prev.Signature != s.Signature:
+			diff.Breaking = append(diff.Breaking, APIChange{Kind: ChangeBreaking, Old: prev.Line(), New: s.Line(),
+				Reason: s.Kind + " changed"})
+		case prev.Value != s.Value:
+			diff.Compatible = append(diff.Compatible, APIChange{Kind: ChangeCompatible, Old: prev.Line(), New: s.Line(),
+				Reason: "constant value changed"})
+		}
+	}
+	return diff
+}
+
+// interfaceExisted reports whether the interface an interface method
+// belongs to is in the old snapshot.
+func interfaceExisted(before map[string]Symbol, method Symbol) bool {
+	iface, _, _ := strings.Cut(method.Name, ".")
+	_, ok := before[Symbol{Package: method.Package, Kind: SymbolType, Name: iface}.key()]
+	return ok
+}
+
+// Text renders the diff grouped by kind, breaking changes first.
+func (d *APIDiff) Text() string {
+	var b strings.Builder
+	section := func(title string, changes []APIChange) {
+		if len(changes) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s (%d):\n", title, len(changes))
+		for _, c := range changes {
+			switch {
+			case c.Old != "" && c.New != "":
+				fmt.Fprintf(&b, "  - %s\n  + %s\n    %s\n", c.Old, c.New, c.Reason)
+			case c.Old != "":
+				fmt.Fprintf(&b, "  - %s\n    %s\n", c.Old, c.Reason)
+			default:
+				fmt.Fprintf(&b, "  + %s\n", c.New)
+				if c.Reason != "added" {
+					fmt.Fprintf(&b, "    %s\n", c.Reason)
+				}
+			}
+		}
+		b.WriteByte('\n')
+	}
+	section("Breaking changes", d.Breaking)
+	section("Compatible changes", d.Compatible)
+	section("Additions", d.Additions)
+	if b.Len() == 0 {
+		return "No API changes.\n"
+	}
+	return b.String()
+}
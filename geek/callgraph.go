@@ -0,0 +1,359 @@
+package geek
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Entry point kinds
+const (
+	EntryMain        = "main"
+	EntryInit        = "init"
+	EntryExported    = "exported"
+	EntryHTTPHandler = "http-handler"
+)
+
+// CallGraph is the static call graph of a module. Functions are identified
+// by their fully qualified name, e.g. "doc/geek.Analyze" or
+// "(*doc/geek.loader).load".
+type CallGraph struct {
+	Module    string     `json:"module"`
+	Functions []FuncNode `json:"functions"`
+	Edges     []CallEdge `json:"edges"`
+	root      string
+	byID      map[string]*FuncNode
+	outgoing  map[string][]CallEdge
+}
+
+// FuncNode is a function or method declared in the module.
+type FuncNode struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Package  string   `json:"package"`
+	Position Position `json:"position"`
+	Entry    []string `json:"entry,omitempty"`
+}
+
+// CallEdge is a call from one function to another. Dynamic edges are calls
+// through an interface or a function value; for interface calls there is
+// one edge for every implementation found in the module.
+type CallEdge struct {
+	Caller   string   `json:"caller"`
+	Callee   string   `json:"callee"`
+	Dynamic  bool     `json:"dynamic,omitempty"`
+	Position Position `json:"position"`
+}
+
+// BuildCallGraph type-checks every package of the module containing dir
+// and records which function calls which.
+func BuildCallGraph(dir string) (*CallGraph, error) {
+	l, err := newLoader(dir)
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := l.loadAll(l.root)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &CallGraph{
+		Module:    l.mod.Module,
+		Functions: []FuncNode{},
+		Edges:     []CallEdge{},
+		root:      l.root,
+	}
+	impls := moduleTypes(pkgs)
+
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok {
+					continue
+				}
+				obj, ok := pkg.Info.Defs[fn.Name].(*types.Func)
+				if !ok {
+					continue
+				}
+				g.Functions = append(g.Functions, FuncNode{
+					ID:       obj.FullName(),
+					Name:     shortFuncName(obj),
+					Package:  pkg.Path,
+					Position: l.position(fn.Name.Pos()),
+					Entry:    entryKinds(pkg, obj),
+				})
+			}
+		}
+		for _, file := range pkg.Files {
+			for _, call := range l.resolveCalls(pkg, file) {
+				g.addCall(call, impls)
+			}
+		}
+	}
+	g.index()
+	return g, nil
+}
+
+// addCall turns a resolved call site into edges.
+func (g *CallGraph) addCall(call CallTarget, impls []*types.Named) {
+	edge := CallEdge{Caller: call.Caller, Callee: call.Callee, Position: call.Position}
+	switch call.Kind {
+	case CallFunction, CallMethod:
+		g.Edges = append(g.Edges, edge)
+	case CallDynamic:
+		edge.Callee += " (func value)"
+		edge.Dynamic = true
+		g.Edges = append(g.Edges, edge)
+	case CallInterface:
+		edge.Dynamic = true
+		g.Edges = append(g.Edges, edge)
+		if call.fn == nil {
+			return
+		}
+		iface, ok := call.fn.Type().(*types.Signature).Recv().Type().Underlying().(*types.Interface)
+		if !ok {
+			return
+		}
+		for _, named := range impls {
+			for _, t := range []types.Type{named, types.NewPointer(named)} {
+				if !types.Implements(t, iface) {
+					continue
+				}
+				obj, _, _ := types.LookupFieldOrMethod(t, false, call.fn.Pkg(), call.fn.Name())
+				if method, ok := obj.(*types.Func); ok {
+					edge.Callee = method.FullName()
+					g.Edges = append(g.Edges, edge)
+				}
+				break
+			}
+		}
+	}
+}
+
+// moduleTypes returns the concrete named types declared in the module.
+func moduleTypes(pkgs []*loadedPackage) []*types.Named {
+	var result []*types.Named
+	for _, pkg := range pkgs {
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || tn.IsAlias() {
+				continue
+			}
+			named, ok := tn.Type().(*types.Named)
+			if !ok || named.TypeParams().Len() > 0 || types.IsInterface(named) {
+				continue
+			}
+			result = append(result, named)
+		}
+	}
+	return result
+}
+
+// entryKinds reports why a function can be called from outside the module.
+func entryKinds(pkg *loadedPackage, fn *types.Func) []string {
+	var kinds []string
+	sig := fn.Type().(*types.Signature)
+	isMethod := sig.Recv() != nil
+
+	switch {
+	case pkg.Types.Name() == "main" && fn.Name() == "main" && !isMethod:
+		kinds = append(kinds, EntryMain)
+	case fn.Name() == "init" && !isMethod:
+		kinds = append(kinds, EntryInit)
+	case pkg.Types.Name() != "main" && fn.Exported():
+		if !isMethod || isExportedType(sig.Recv().Type()) {
+			kinds = append(kinds, EntryExported)
+		}
+	}
+
+	// Plain handler funcs as well as ServeHTTP methods
+	if isHTTPHandler(sig) {
+		kinds = append(kinds, EntryHTTPHandler)
+	}
+	return kinds
+}
+
+func isExportedType(t types.Type) bool {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Exported()
+}
+
+// isHTTPHandler matches func(http.ResponseWriter, *http.Request).
+func isHTTPHandler(sig *types.Signature) bool {
+	params := sig.Params()
+	return sig.Results().Len() == 0 && params.Len() == 2 &&
+		types.TypeString(params.At(0).Type(), nil) == "net/http.ResponseWriter" &&
+		types.TypeString(params.At(1).Type(), nil) == "*net/http.Request"
+}
+
+// shortFuncName is the name of a function qualified by its package name
+// instead of its import path, e.g. "geek.Analyze" or "geek.(*loader).load".
+func shortFuncName(fn *types.Func) string {
+	qualifier := func(p *types.Package) string { return "" }
+	sig := fn.Type().(*types.Signature)
+	prefix := ""
+	if fn.Pkg() != nil {
+		prefix = fn.Pkg().Name() + "."
+	}
+	if sig.Recv() == nil {
+		return prefix + fn.Name()
+	}
+	recv := types.TypeString(sig.Recv().Type(), qualifier)
+	if strings.HasPrefix(recv, "*") {
+		recv = "(" + recv + ")"
+	}
+	return prefix + recv + "." + fn.Name()
+}
+
+func (g *CallGraph) index() {
+	g.byID = map[string]*FuncNode{}
+	for i := range g.Functions {
+		g.byID[g.Functions[i].ID] = &g.Functions[i]
+	}
+	g.outgoing = map[string][]CallEdge{}
+	seen := map[[2]string]bool{}
+	for _, edge := range g.Edges {
+		key := [2]string{edge.Caller, edge.Callee}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		g.outgoing[edge.Caller] = append(g.outgoing[edge.Caller], edge)
+	}
+	// Sorted once here, so rendering reads the edges without reordering them
+	for _, edges := range g.outgoing {
+		sort.Slice(edges, func(i, j int) bool { return edges[i].Callee < edges[j].Callee })
+	}
+}
+
+// EntryPoints returns the functions that can be called from outside the
+// module: main and init functions, exported APIs and HTTP handlers.
+func (g *CallGraph) EntryPoints() []FuncNode {
+	var entries []FuncNode
+	for _, fn := range g.Functions {
+		if len(fn.Entry) > 0 {
+			entries = append(entries, fn)
+		}
+	}
+	return entries
+}
+
+// FunctionsIn returns the functions declared in the file at path.
+func (g *CallGraph) FunctionsIn(path string) []FuncNode {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+	rel, err := filepath.Rel(g.root, abs)
+	if err != nil {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+
+	var fns []FuncNode
+	for _, fn := range g.Functions {
+		if fn.Position.File == rel {
+			fns = append(fns, fn)
+		}
+	}
+	return fns
+}
+
+// CallChainMermaid renders the calls reachable from the function id as a
+// Mermaid flowchart, following at most depth levels of calls. Dynamic
+// calls are drawn dashed; functions outside the module are leaves.
+func (g *CallGraph) CallChainMermaid(id string, depth int) string {
+	if g.byID == nil {
+		g.index()
+	}
+	ids := map[string]string{}
+	nodeID := func(fn string) string {
+		if _, ok := ids[fn]; !ok {
+			ids[fn] = fmt.Sprintf("n%d", len(ids))
+		}
+		return ids[fn]
+	}
+	label := func(fn string) string {
+		if node, ok := g.byID[fn]; ok {
+			return node.Name
+		}
+		return fn
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	fmt.Fprintf(&b, "  %s[\"%s\"]\n", nodeID(id), mermaidEscape(label(id)))
+
+	visited := map[string]bool{id: true}
+	level := []string{id}
+	for d := 0; d < depth && len(level) > 0; d++ {
+		var next []string
+		for _, caller := range level {
+			for _, edge := range g.outgoing[caller] {
+				_, known := ids[edge.Callee]
+				to := nodeID(edge.Callee)
+				if !known {
+					shape := "[\"%s\"]"
+					if _, inModule := g.byID[edge.Callee]; !inModule {
+						shape = "([\"%s\"])"
+					}
+					fmt.Fprintf(&b, "  %s"+shape+"\n", to, mermaidEscape(label(edge.Callee)))
+				}
+				arrow := "-->"
+				if edge.Dynamic {
+					arrow = "-.->"
+				}
+				fmt.Fprintf(&b, "  %s %s %s\n", ids[caller], arrow, to)
+
+				if _, inModule := g.byID[edge.Callee]; inModule && !visited[edge.Callee] {
+					visited[edge.Callee] = true
+					next = append(next, edge.Callee)
+				}
+			}
+		}
+		level = next
+	}
+
+	// Mark functions whose calls were cut off by the depth limit
+	for _, fn := range level {
+		if len(g.outgoing[fn]) > 0 {
+			fmt.Fprintf(&b, "  %s --> %s_more[\"…\"]\n", ids[fn], ids[fn])
+		}
+	}
+	return b.String()
+}
+
+// CallChainsMarkdown renders a call-chain flowchart for each function
+// declared in the file at path.
+func (g *CallGraph) CallChainsMarkdown(path string, depth int) string {
+	fns := g.FunctionsIn(path)
+	if len(fns) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("## Call chains\n")
+	for _, fn := range fns {
+		if len(g.outgoing[fn.ID]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n", fn.Name)
+		if len(fn.Entry) > 0 {
+			fmt.Fprintf(&b, "Entry point: %s\n\n", strings.Join(fn.Entry, ", "))
+		}
+		fmt.Fprintf(&b, "```mermaid\n%s```\n", g.CallChainMermaid(fn.ID, depth))
+	}
+	return b.String()
+}
+
+// mermaidEscape makes text safe inside a quoted Mermaid label.
+func mermaidEscape(text string) string {
+	return strings.ReplaceAll(text, `"`, "#quot;")
+}
@@ -0,0 +1,398 @@
+package geek
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// Concurrency catalogs the goroutines, channels, selects and sync
+// primitives of a file. Goroutines and function bodies are called actors;
+// an actor is named after its function, and goroutines started from a
+// function literal are named "F·go@line".
+type Concurrency struct {
+	Goroutines []Goroutine `json:"goroutines"`
+	Channels   []Channel   `json:"channels"`
+	Selects    []Select    `json:"selects"`
+	Sync       []SyncUse   `json:"sync"`
+}
+
+// Goroutine is a go statement.
+type Goroutine struct {
+	Launcher string `json:"launcher"`
+	Target   string `json:"target"`
+	Position
+}
+
+// Channel is a channel variable, field or parameter. Direction is "both",
+// "send" or "receive"; Capacity is the buffer size expression of the make
+// call, if any.
+type Channel struct {
+	Name      string   `json:"name"`
+	ElemType  string   `json:"elemType"`
+	Direction string   `json:"direction"`
+	Capacity  string   `json:"capacity,omitempty"`
+	Senders   []string `json:"senders"`
+	Receivers []string `json:"receivers"`
+	Position
+}
+
+// Select is a select statement and the channel operations it waits on.
+type Select struct {
+	Actor string   `json:"actor"`
+	Cases []string `json:"cases"`
+	Position
+}
+
+// SyncUse is a sync primitive and the methods called on it.
+type SyncUse struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Actors  []string `json:"actors"`
+	Methods []string `json:"methods"`
+	Position
+}
+
+var syncTypes = map[string]bool{
+	"sync.Mutex": true, "sync.RWMutex": true, "sync.WaitGroup": true,
+	"sync.Once": true, "sync.Cond": true, "sync.Map": true, "sync.Pool": true,
+	"errgroup.Group": true,
+}
+
+// concurrencyWalker collects concurrency facts. Without type information
+// channels and sync values are matched by name, so a field and a local
+// variable with the same name are treated as one.
+type concurrencyWalker struct {
+	at       func(token.Pos) Position
+	result   *Concurrency
+	channels map[string]*Channel
+	sync     map[string]*SyncUse
+	actors   []string
+
+	// receiver maps the receiver variable of the current method to its type
+	receiver map[string]string
+}
+
+func analyzeConcurrency(file *ast.File, at func(token.Pos) Position) *Concurrency {
+	w := &concurrencyWalker{
+		at: at,
+		result: &Concurrency{
+			Goroutines: []Goroutine{},
+			Channels:   []Channel{},
+			Selects:    []Select{},
+			Sync:       []SyncUse{},
+		},
+		channels: map[string]*Channel{},
+		sync:     map[string]*SyncUse{},
+	}
+
+	// Declarations first, so uses earlier in the file than the declaration
+	// (e.g. methods above their struct) are still matched
+	ast.Inspect(file, w.declarations)
+	w.actors = []string{""}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Body != nil {
+			w.actors = []string{funcDeclName(fn)}
+			w.receiver = map[string]string{}
+			if fn.Recv != nil && len(fn.Recv.List) > 0 && len(fn.Recv.List[0].Names) > 0 {
+				w.receiver[fn.Recv.List[0].Names[0].Name] = receiverTypeName(fn.Recv.List[0].Type)
+			}
+			ast.Inspect(fn.Body, w.uses)
+		}
+	}
+
+	for _, name := range sortedKeys(w.channels) {
+		ch := w.channels[name]
+		ch.Senders = removeDuplicates(ch.Senders)
+		ch.Receivers = removeDuplicates(ch.Receivers)
+		w.result.Channels = append(w.result.Channels, *ch)
+	}
+	for _, name := range sortedKeys(w.sync) {
+		use := w.sync[name]
+		use.Actors = removeDuplicates(use.Actors)
+		use.Methods = removeDuplicates(use.Methods)
+		w.result.Sync = append(w.result.Sync, *use)
+	}
+	sort.SliceStable(w.result.Channels, func(i, j int) bool {
+		return w.result.Channels[i].Line < w.result.Channels[j].Line
+	})
+	sort.SliceStable(w.result.Sync, func(i, j int) bool {
+		return w.result.Sync[i].Line < w.result.Sync[j].Line
+	})
+	return w.result
+}
+
+func funcDeclName(fn *ast.FuncDecl) string {
+	if fn.Recv != nil && len(fn.Recv.List) > 0 {
+		return receiverTypeName(fn.Recv.List[0].Type) + "." + fn.Name.Name
+	}
+	return fn.Name.Name
+}
+
+// declarations records channels and sync primitives wherever they are
+// declared: variables, struct fields, parameters and make calls.
+func (w *concurrencyWalker) declarations(n ast.Node) bool {
+	switch node := n.(type) {
+	case *ast.Field:
+		for _, name := range node.Names {
+			w.declare(name.Name, node.Type, nil, name.Pos())
+		}
+	case *ast.ValueSpec:
+		for i, name := range node.Names {
+			var value ast.Expr
+			if i < len(node.Values) {
+				value = node.Values[i]
+			}
+			w.declare(name.Name, node.Type, value, name.Pos())
+		}
+	case *ast.AssignStmt:
+		if len(node.Lhs) == len(node.Rhs) {
+			for i, lhs := range node.Lhs {
+				w.declare(channelKey(lhs), nil, node.Rhs[i], lhs.Pos())
+			}
+		}
+	}
+	return true
+}
+
+func (w *concurrencyWalker) declare(name string, typ, value ast.Expr, pos token.Pos) {
+	if name == "" || name == "_" {
+		return
+	}
+	capacity := ""
+	if call, ok := value.(*ast.CallExpr); ok && typ == nil {
+		if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == "make" && len(call.Args) > 0 {
+			typ = call.Args[0]
+			if len(call.Args) > 1 {
+				capacity = types.ExprString(call.Args[1])
+			}
+		}
+	}
+	if lit, ok := value.(*ast.CompositeLit); ok && typ == nil {
+		typ = lit.Type
+	}
+	if unary, ok := value.(*ast.UnaryExpr); ok && typ == nil && unary.Op == token.AND {
+		if lit, ok := unary.X.(*ast.CompositeLit); ok {
+			typ = lit.Type
+		}
+	}
+	if typ == nil {
+		return
+	}
+
+	if chanType, ok := typ.(*ast.ChanType); ok {
+		if _, seen := w.channels[name]; seen {
+			return
+		}
+		direction := "both"
+		switch chanType.Dir {
+		case ast.SEND:
+			direction = "send"
+		case ast.RECV:
+			direction = "receive"
+		}
+		w.channels[name] = &Channel{
+			Name:      name,
+			ElemType:  types.ExprString(chanType.Value),
+			Direction: direction,
+			Capacity:  capacity,
+			Senders:   []string{},
+			Receivers: []string{},
+			Position:  w.at(pos),
+		}
+		return
+	}
+
+	typeName := strings.TrimPrefix(types.ExprString(typ), "*")
+	if syncTypes[typeName] {
+		if _, seen := w.sync[name]; !seen {
+			w.sync[name] = &SyncUse{Name: name, Type: typeName, Actors: []string{}, Methods: []string{}, Position: w.at(pos)}
+		}
+	}
+}
+
+// channelKey names the channel or sync value an expression refers to:
+// the identifier, or the last field of a selector.
+func channelKey(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	case *ast.ParenExpr:
+		return channelKey(e.X)
+	case *ast.StarExpr:
+		return channelKey(e.X)
+	}
+	return ""
+}
+
+func (w *concurrencyWalker) actor() string {
+	return w.actors[len(w.actors)-1]
+}
+
+// uses records sends, receives, go statements, selects and sync calls,
+// attributing each to the actor whose code contains it.
+func (w *concurrencyWalker) uses(n ast.Node) bool {
+	switch node := n.(type) {
+	case *ast.GoStmt:
+		g := Goroutine{Launcher: w.actor(), Target: calleeName(node.Call), Position: w.at(node.Pos())}
+		// Name methods on the receiver the same way their actors are named
+		if sel, ok := node.Call.Fun.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok && w.receiver[ident.Name] != "" {
+				g.Target = w.receiver[ident.Name] + "." + sel.Sel.Name
+			}
+		}
+		for _, arg := range node.Call.Args {
+			ast.Inspect(arg, w.uses)
+		}
+		if lit, ok := node.Call.Fun.(*ast.FuncLit); ok {
+			g.Target = fmt.Sprintf("%s·go@%d", w.actor(), g.Line)
+			w.result.Goroutines = append(w.result.Goroutines, g)
+			w.actors = append(w.actors, g.Target)
+			ast.Inspect(lit.Body, w.uses)
+			w.actors = w.actors[:len(w.actors)-1]
+			return false
+		}
+		w.result.Goroutines = append(w.result.Goroutines, g)
+		return false
+
+	case *ast.SendStmt:
+		if ch, ok := w.channels[channelKey(node.Chan)]; ok {
+			ch.Senders = append(ch.Senders, w.actor())
+		}
+
+	case *ast.UnaryExpr:
+		if node.Op == token.ARROW {
+			if ch, ok := w.channels[channelKey(node.X)]; ok {
+				ch.Receivers = append(ch.Receivers, w.actor())
+			}
+		}
+
+	case *ast.RangeStmt:
+		if ch, ok := w.channels[channelKey(node.X)]; ok {
+			ch.Receivers = append(ch.Receivers, w.actor())
+		}
+
+	case *ast.SelectStmt:
+		sel := Select{Actor: w.actor(), Cases: []string{}, Position: w.at(node.Pos())}
+		for _, stmt := range node.Body.List {
+			sel.Cases = append(sel.Cases, commCase(stmt.(*ast.CommClause)))
+		}
+		w.result.Selects = append(w.result.Selects, sel)
+
+	case *ast.CallExpr:
+		if sel, ok := node.Fun.(*ast.SelectorExpr); ok {
+			if use, ok := w.sync[channelKey(sel.X)]; ok {
+				use.Actors = append(use.Actors, w.actor())
+				use.Methods = append(use.Methods, sel.Sel.Name)
+			}
+		}
+	}
+	return true
+}
+
+// commCase describes a select case, e.g. "receive results" or "send out".
+func commCase(clause *ast.CommClause) string {
+	switch comm := clause.Comm.(type) {
+	case nil:
+		return "default"
+	case *ast.SendStmt:
+		return "send " + types.ExprString(comm.Chan)
+	case *ast.ExprStmt:
+		if recv, ok := comm.X.(*ast.UnaryExpr); ok {
+			return "receive " + types.ExprString(recv.X)
+		}
+	case *ast.AssignStmt:
+		if recv, ok := comm.Rhs[0].(*ast.UnaryExpr); ok {
+			return "receive " + types.ExprString(recv.X)
+		}
+	}
+	return "case"
+}
+
+// Empty reports whether nothing concurrent was found.
+func (c *Concurrency) Empty() bool {
+	return c == nil || len(c.Goroutines)+len(c.Channels)+len(c.Selects)+len(c.Sync) == 0
+}
+
+// Mermaid draws actors and channels: thick arrows start goroutines, plain
+// arrows go from senders to a channel and from a channel to receivers.
+func (c *Concurrency) Mermaid() string {
+	ids := map[string]string{}
+	var nodes, edges strings.Builder
+	actor := func(name string) string {
+		if id, ok := ids["actor "+name]; ok {
+			return id
+		}
+		id := fmt.Sprintf("a%d", len(ids))
+		ids["actor "+name] = id
+		fmt.Fprintf(&nodes, "  %s(\"%s\")\n", id, mermaidEscape(name))
+		return id
+	}
+
+	for _, g := range c.Goroutines {
+		fmt.Fprintf(&edges, "  %s ==>|go| %s\n", actor(g.Launcher), actor(g.Target))
+	}
+	for i, ch := range c.Channels {
+		id := fmt.Sprintf("c%d", i)
+		fmt.Fprintf(&nodes, "  %s{{\"%s chan %s\"}}\n", id, mermaidEscape(ch.Name), mermaidEscape(ch.ElemType))
+		for _, sender := range ch.Senders {
+			fmt.Fprintf(&edges, "  %s -->|send| %s\n", actor(sender), id)
+		}
+		for _, receiver := range ch.Receivers {
+			fmt.Fprintf(&edges, "  %s -->|receive| %s\n", id, actor(receiver))
+		}
+	}
+	for i, use := range c.Sync {
+		id := fmt.Sprintf("s%d", i)
+		fmt.Fprintf(&nodes, "  %s[/\"%s %s\"/]\n", id, mermaidEscape(use.Name), use.Type)
+		for _, user := range use.Actors {
+			fmt.Fprintf(&edges, "  %s -.- %s\n", actor(user), id)
+		}
+	}
+	return "flowchart LR\n" + nodes.String() + edges.String()
+}
+
+// ConcurrencyMarkdown renders the concurrency section of a note, or ""
+// when the file has nothing concurrent in it.
+func ConcurrencyMarkdown(result *AnalysisResult, noteDir string) string {
+	c := result.Concurrency
+	if c.Empty() {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("## Concurrency\n\n")
+	fmt.Fprintf(&b, "```mermaid\n%s```\n", c.Mermaid())
+
+	if len(c.Goroutines) > 0 {
+		b.WriteString("\n| Goroutine | Started by | Location |\n| --- | --- | --- |\n")
+		for _, g := range c.Goroutines {
+			fmt.Fprintf(&b, "| `%s` | `%s` | %s |\n", g.Target, g.Launcher, Link(g.Position, noteDir))
+		}
+	}
+	if len(c.Channels) > 0 {
+		b.WriteString("\n| Channel | Element | Direction | Senders | Receivers | Location |\n| --- | --- | --- | --- | --- | --- |\n")
+		for _, ch := range c.Channels {
+			fmt.Fprintf(&b, "| `%s` | `%s` | %s | %s | %s | %s |\n", ch.Name, ch.ElemType, ch.Direction,
+				codeList(ch.Senders), codeList(ch.Receivers), Link(ch.Position, noteDir))
+		}
+	}
+	if len(c.Selects) > 0 {
+		b.WriteString("\n| Select in | Cases | Location |\n| --- | --- | --- |\n")
+		for _, sel := range c.Selects {
+			fmt.Fprintf(&b, "| `%s` | %s | %s |\n", sel.Actor, strings.Join(sel.Cases, ", "), Link(sel.Position, noteDir))
+		}
+	}
+	if len(c.Sync) > 0 {
+		b.WriteString("\n| Primitive | Type | Methods | Used by | Location |\n| --- | --- | --- | --- | --- |\n")
+		for _, use := range c.Sync {
+			fmt.Fprintf(&b, "| `%s` | `%s` | %s | %s | %s |\n", use.Name, use.Type,
+				codeList(use.Methods), codeList(use.Actors), Link(use.Position, noteDir))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,409 @@
+package geek
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Enum is a named type with a set of constants of that type, typically
+// declared with iota.
+type Enum struct {
+	Type     string      `json:"type"`
+	Values   []EnumValue `json:"values"`
+	Stringer bool        `json:"stringer"`
+	Position Position    `json:"position"`
+}
+
+// EnumValue is one constant of an enum. Label is what String returns for
+// it, when geek can tell.
+type EnumValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	Position
+}
+
+// StateMachine is an enum used as a state: switch statements over it that
+// assign or return the next state.
+type StateMachine struct {
+	Type        string       `json:"type"`
+	Initial     string       `json:"initial,omitempty"`
+	Transitions []Transition `json:"transitions"`
+}
+
+// Transition is a move from one state to another inside Function.
+type Transition struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Function string `json:"function"`
+	Position
+}
+
+// enums finds the enum types of pkg: named basic types with at least two
+// constants.
+func (l *loader) enums(pkg *loadedPackage) []Enum {
+	consts := map[*types.TypeName][]*types.Const{}
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		c, ok := scope.Lookup(name).(*types.Const)
+		if !ok {
+			continue
+		}
+		named, ok := c.Type().(*types.Named)
+		if !ok || named.Obj().Pkg() != pkg.Types {
+			continue
+		}
+		consts[named.Obj()] = append(consts[named.Obj()], c)
+	}
+
+	result := []Enum{}
+	for tn, values := range consts {
+		if len(values) < 2 {
+			continue
+		}
+		sort.Slice(values, func(i, j int) bool { return values[i].Pos() < values[j].Pos() })
+		labels := stringLabels(pkg, tn)
+		enum := Enum{
+			Type:     tn.Name(),
+			Values:   []EnumValue{},
+			Stringer: hasStringMethod(tn.Type()),
+			Position: l.position(tn.Pos()),
+		}
+		for _, c := range values {
+			enum.Values = append(enum.Values, EnumValue{
+				Name:     c.Name(),
+				Value:    c.Val().ExactString(),
+				Label:    labels[c],
+				Position: l.position(c.Pos()),
+			})
+		}
+		result = append(result, enum)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Type < result[j].Type })
+	return result
+}
+
+// hasStringMethod reports whether t implements fmt.Stringer.
+func hasStringMethod(t types.Type) bool {
+	obj, _, _ := types.LookupFieldOrMethod(t, false, nil, "String")
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	return sig.Params().Len() == 0 && sig.Results().Len() == 1 &&
+		types.Identical(sig.Results().At(0).Type(), types.Typ[types.String])
+}
+
+// stringLabels reads what the String method of tn returns for each
+// constant, when it is written as a switch returning string literals or
+// as an index into a string table.
+func stringLabels(pkg *loadedPackage, tn *types.TypeName) map[*types.Const]string {
+	labels := map[*types.Const]string{}
+	constOf := func(e ast.Expr) *types.Const {
+		c, ok := pkg.Info.Uses[identOf(e)].(*types.Const)
+		if !ok || !types.Identical(c.Type(), tn.Type()) {
+			return nil
+		}
+		return c
+	}
+	str := func(e ast.Expr) (string, bool) {
+		lit, ok := e.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return "", false
+		}
+		s, err := strconv.Unquote(lit.Value)
+		return s, err == nil
+	}
+	// table records the strings of a composite literal, either keyed by
+	// the constants or in the order of their values
+	table := func(lit *ast.CompositeLit) {
+		for i, elt := range lit.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				if c := constOf(kv.Key); c != nil {
+					if s, ok := str(kv.Value); ok {
+						labels[c] = s
+					}
+				}
+				continue
+			}
+			s, ok := str(elt)
+			if !ok {
+				continue
+			}
+			for _, obj := range pkg.Info.Defs {
+				c, ok := obj.(*types.Const)
+				if !ok || !types.Identical(c.Type(), tn.Type()) {
+					continue
+				}
+				if c.Val().Kind() != constant.Int {
+					continue
+				}
+				if v, exact := constant.Int64Val(c.Val()); exact && v == int64(i) {
+					labels[c] = s
+				}
+			}
+		}
+	}
+
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil || fn.Name.Name != "String" || fn.Recv == nil {
+				continue
+			}
+			if receiverTypeName(fn.Recv.List[0].Type) != tn.Name() {
+				continue
+			}
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				switch node := n.(type) {
+				case *ast.CaseClause:
+					if len(node.Body) == 0 {
+						return true
+					}
+					ret, ok := node.Body[0].(*ast.ReturnStmt)
+					if !ok || len(ret.Results) != 1 {
+						return true
+					}
+					if s, ok := str(ret.Results[0]); ok {
+						for _, e := range node.List {
+							if c := constOf(e); c != nil {
+								labels[c] = s
+							}
+						}
+					}
+				case *ast.CompositeLit:
+					table(node)
+				case *ast.Ident:
+					// A package-level table such as stateNames[s]
+					v, ok := pkg.Info.Uses[node].(*types.Var)
+					if !ok || v.Parent() != pkg.Types.Scope() {
+						return true
+					}
+					if lit := packageVarLiteral(pkg, v); lit != nil {
+						table(lit)
+					}
+				}
+				return true
+			})
+		}
+	}
+	return labels
+}
+
+// packageVarLiteral returns the composite literal a package variable is
+// initialized with.
+func packageVarLiteral(pkg *loadedPackage, v *types.Var) *ast.CompositeLit {
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, name := range vs.Names {
+					if pkg.Info.Defs[name] != v || i >= len(vs.Values) {
+						continue
+					}
+					lit, _ := vs.Values[i].(*ast.CompositeLit)
+					return lit
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// identOf returns the identifier naming e, for plain and qualified names.
+func identOf(e ast.Expr) *ast.Ident {
+	switch e := e.(type) {
+	case *ast.Ident:
+		return e
+	case *ast.SelectorExpr:
+		return e.Sel
+	case *ast.ParenExpr:
+		return identOf(e.X)
+	}
+	return nil
+}
+
+// stateMachines finds switch statements over an enum whose cases assign or
+// return another value of the enum.
+func (l *loader) stateMachines(pkg *loadedPackage, enums []Enum) []StateMachine {
+	machines := map[string]*StateMachine{}
+	isEnum := map[string]bool{}
+	for _, enum := range enums {
+		isEnum[enum.Type] = true
+	}
+	enumOf := func(t types.Type) string {
+		named, ok := t.(*types.Named)
+		if !ok || named.Obj().Pkg() != pkg.Types || !isEnum[named.Obj().Name()] {
+			return ""
+		}
+		return named.Obj().Name()
+	}
+	constOf := func(e ast.Expr, enum string) string {
+		c, ok := pkg.Info.Uses[identOf(e)].(*types.Const)
+		if !ok || enumOf(c.Type()) != enum {
+			return ""
+		}
+		return c.Name()
+	}
+
+	seen := map[Transition]bool{}
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			function := funcDeclName(fn)
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				sw, ok := n.(*ast.SwitchStmt)
+				if !ok || sw.Tag == nil {
+					return true
+				}
+				enum := enumOf(pkg.Info.TypeOf(sw.Tag))
+				if enum == "" {
+					return true
+				}
+				for _, stmt := range sw.Body.List {
+					clause := stmt.(*ast.CaseClause)
+					var froms []string
+					for _, e := range clause.List {
+						if from := constOf(e, enum); from != "" {
+							froms = append(froms, from)
+						}
+					}
+					for _, next := range nextStates(clause, enum, constOf) {
+						for _, from := range froms {
+							t := Transition{From: from, To: next.name, Function: function, Position: l.position(next.pos)}
+							key := Transition{From: t.From, To: t.To, Function: t.Function}
+							if seen[key] {
+								continue
+							}
+							seen[key] = true
+							if machines[enum] == nil {
+								machines[enum] = &StateMachine{Type: enum}
+							}
+							machines[enum].Transitions = append(machines[enum].Transitions, t)
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	result := []StateMachine{}
+	for _, enum := range enums {
+		machine, ok := machines[enum.Type]
+		if !ok {
+			continue
+		}
+		for _, value := range enum.Values {
+			if value.Value == "0" {
+				machine.Initial = value.Name
+				break
+			}
+		}
+		result = append(result, *machine)
+	}
+	return result
+}
+
+type nextState struct {
+	name string
+	pos  token.Pos
+}
+
+// nextStates lists the enum constants a case clause assigns or returns.
+func nextStates(clause *ast.CaseClause, enum string, constOf func(ast.Expr, string) string) []nextState {
+	var next []nextState
+	for _, stmt := range clause.Body {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			var values []ast.Expr
+			switch node := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.AssignStmt:
+				values = node.Rhs
+			case *ast.ReturnStmt:
+				values = node.Results
+			}
+			for _, v := range values {
+				if name := constOf(v, enum); name != "" {
+					next = append(next, nextState{name: name, pos: v.Pos()})
+				}
+			}
+			return true
+		})
+	}
+	return next
+}
+
+// StateDiagram renders the machine as a Mermaid stateDiagram-v2.
+func (m StateMachine) StateDiagram() string {
+	var b strings.Builder
+	b.WriteString("stateDiagram-v2\n")
+	if m.Initial != "" {
+		fmt.Fprintf(&b, "  [*] --> %s\n", m.Initial)
+	}
+	drawn := map[[2]string]bool{}
+	for _, t := range m.Transitions {
+		key := [2]string{t.From, t.To}
+		if drawn[key] {
+			continue
+		}
+		drawn[key] = true
+		fmt.Fprintf(&b, "  %s --> %s\n", t.From, t.To)
+	}
+	return b.String()
+}
+
+// EnumsMarkdown renders the "Enums" and "State machines" sections of a
+// package note.
+func EnumsMarkdown(pkg *PackageResult, noteDir string) string {
+	if len(pkg.Enums) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("## Enums\n")
+	for _, enum := range pkg.Enums {
+		fmt.Fprintf(&b, "\n### %s\n\n", enum.Type)
+		if enum.Stringer {
+			b.WriteString("Implements `fmt.Stringer`.\n\n")
+		}
+		b.WriteString("| Constant | Value | String | Location |\n")
+		b.WriteString("| --- | --- | --- | --- |\n")
+		for _, value := range enum.Values {
+			label := ""
+			if value.Label != "" {
+				label = "`" + strings.ReplaceAll(value.Label, "|", `\|`) + "`"
+			}
+			fmt.Fprintf(&b, "| `%s` | `%s` | %s | %s |\n", value.Name, value.Value, label, Link(value.Position, noteDir))
+		}
+	}
+
+	if len(pkg.States) == 0 {
+		return b.String()
+	}
+	b.WriteString("\n## State machines\n")
+	for _, machine := range pkg.States {
+		fmt.Fprintf(&b, "\n### %s\n\n", machine.Type)
+		fmt.Fprintf(&b, "```mermaid\n%s```\n\n", machine.StateDiagram())
+		b.WriteString("| From | To | Function | Location |\n")
+		b.WriteString("| --- | --- | --- | --- |\n")
+		for _, t := range machine.Transitions {
+			fmt.Fprintf(&b, "| `%s` | `%s` | `%s` | %s |\n", t.From, t.To, t.Function, Link(t.Position, noteDir))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,315 @@
+package geek
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// ErrorSurface describes how a package creates, returns and handles errors.
+type ErrorSurface struct {
+	Returning []Item     `json:"returning"`
+	Sentinels []Item     `json:"sentinels"`
+	Types     []Item     `json:"types"`
+	Wrapped   []ErrorUse `json:"wrapped"`
+	Checked   []ErrorUse `json:"checked"`
+	Ignored   []ErrorUse `json:"ignored"`
+	Fatal     []ErrorUse `json:"fatal"`
+}
+
+// ErrorUse is a call that does something with an error, and the function
+// it appears in.
+type ErrorUse struct {
+	Function string `json:"function"`
+	Call     string `json:"call"`
+	Position
+}
+
+var errorType = types.Universe.Lookup("error").Type()
+
+// isError reports whether t is the error interface or a concrete type
+// implementing it.
+func isError(t types.Type) bool {
+	if t == nil {
+		return false
+	}
+	if types.Identical(t, errorType) {
+		return true
+	}
+	iface := errorType.Underlying().(*types.Interface)
+	return !types.IsInterface(t) && types.Implements(t, iface)
+}
+
+// Calls whose error result is conventionally ignored
+var uncheckedCalls = []string{
+	"fmt.Print", "fmt.Fprint",
+	"(*strings.Builder).Write", "(*bytes.Buffer).Write",
+}
+
+// errorSurface collects the error flow of a type-checked package.
+func (l *loader) errorSurface(pkg *loadedPackage) *ErrorSurface {
+	s := &ErrorSurface{
+		Returning: []Item{},
+		Sentinels: []Item{},
+		Types:     []Item{},
+		Wrapped:   []ErrorUse{},
+		Checked:   []ErrorUse{},
+		Ignored:   []ErrorUse{},
+		Fatal:     []ErrorUse{},
+	}
+
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		switch obj := scope.Lookup(name).(type) {
+		case *types.Var:
+			if isError(obj.Type()) {
+				s.Sentinels = append(s.Sentinels, Item{Name: name, Position: l.position(obj.Pos())})
+			}
+		case *types.TypeName:
+			if obj.IsAlias() || types.IsInterface(obj.Type()) {
+				continue
+			}
+			if isError(obj.Type()) {
+				s.Types = append(s.Types, Item{Name: name, Position: l.position(obj.Pos())})
+			} else if isError(types.NewPointer(obj.Type())) {
+				s.Types = append(s.Types, Item{Name: "*" + name, Position: l.position(obj.Pos())})
+			}
+		}
+	}
+
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Body == nil {
+				continue
+			}
+			name := funcDeclName(fn)
+			if results := fn.Type.Results; results != nil && len(results.List) > 0 {
+				last := results.List[len(results.List)-1]
+				if isError(pkg.Info.TypeOf(last.Type)) {
+					s.Returning = append(s.Returning, Item{Name: name, Position: l.position(fn.Name.Pos())})
+				}
+			}
+			w := errorWalker{l: l, info: pkg.Info, surface: s, function: name}
+			w.walk(fn.Body, false)
+		}
+	}
+	return s
+}
+
+type errorWalker struct {
+	l        *loader
+	info     *types.Info
+	surface  *ErrorSurface
+	function string
+}
+
+// walk inspects n; inCheck is set inside the body of an `if err != nil`.
+func (w *errorWalker) walk(n ast.Node, inCheck bool) {
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.IfStmt:
+			if node.Init != nil {
+				w.walk(node.Init, inCheck)
+			}
+			w.walk(node.Cond, inCheck)
+			w.walk(node.Body, inCheck || w.checksError(node.Cond))
+			if node.Else != nil {
+				w.walk(node.Else, inCheck)
+			}
+			return false
+		case *ast.AssignStmt:
+			w.ignoredInAssign(node)
+		case *ast.ExprStmt:
+			if call, ok := node.X.(*ast.CallExpr); ok && w.dropsError(call) {
+				w.add(&w.surface.Ignored, call)
+			}
+		case *ast.CallExpr:
+			w.call(node, inCheck)
+		}
+		return true
+	})
+}
+
+func (w *errorWalker) add(uses *[]ErrorUse, call *ast.CallExpr) {
+	*uses = append(*uses, ErrorUse{
+		Function: w.function,
+		Call:     shorten(types.ExprString(call), 80),
+		Position: w.l.position(call.Pos()),
+	})
+}
+
+func (w *errorWalker) call(call *ast.CallExpr, inCheck bool) {
+	callee := resolveCall(w.info, call).Callee
+	switch {
+	case callee == "errors.Is" || callee == "errors.As":
+		w.add(&w.surface.Checked, call)
+	case callee == "errors.Join":
+		w.add(&w.surface.Wrapped, call)
+	case callee == "fmt.Errorf":
+		if len(call.Args) == 0 {
+			return
+		}
+		if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			if format, err := strconv.Unquote(lit.Value); err == nil && strings.Contains(format, "%w") {
+				w.add(&w.surface.Wrapped, call)
+			}
+		}
+	case isFatal(callee):
+		if inCheck || w.hasErrorArg(call) {
+			w.add(&w.surface.Fatal, call)
+		}
+	}
+}
+
+// isFatal matches calls that end the program or unwind the stack.
+func isFatal(callee string) bool {
+	callee = strings.TrimPrefix(callee, "(*log.Logger).")
+	callee = strings.TrimPrefix(callee, "log.")
+	return callee == "panic" || callee == "os.Exit" ||
+		strings.HasPrefix(callee, "Fatal") || strings.HasPrefix(callee, "Panic")
+}
+
+func (w *errorWalker) hasErrorArg(call *ast.CallExpr) bool {
+	for _, arg := range call.Args {
+		if isError(w.info.TypeOf(arg)) {
+			return true
+		}
+	}
+	return false
+}
+
+// checksError reports whether cond compares an error with nil.
+func (w *errorWalker) checksError(cond ast.Expr) bool {
+	bin, ok := cond.(*ast.BinaryExpr)
+	if !ok {
+		return false
+	}
+	switch bin.Op {
+	case token.LAND, token.LOR:
+		return w.checksError(bin.X) || w.checksError(bin.Y)
+	case token.NEQ:
+		isNil := func(e ast.Expr) bool {
+			tv, ok := w.info.Types[e]
+			return ok && tv.IsNil()
+		}
+		return (isNil(bin.Y) && isError(w.info.TypeOf(bin.X))) ||
+			(isNil(bin.X) && isError(w.info.TypeOf(bin.Y)))
+	}
+	return false
+}
+
+// ignoredInAssign records error results assigned to the blank identifier.
+func (w *errorWalker) ignoredInAssign(assign *ast.AssignStmt) {
+	blank := func(e ast.Expr) bool {
+		ident, ok := e.(*ast.Ident)
+		return ok && ident.Name == "_"
+	}
+	if len(assign.Rhs) == 1 && len(assign.Lhs) > 1 {
+		call, ok := assign.Rhs[0].(*ast.CallExpr)
+		if !ok {
+			return
+		}
+		tuple, ok := w.info.TypeOf(call).(*types.Tuple)
+		if !ok || tuple.Len() != len(assign.Lhs) {
+			return
+		}
+		for i, lhs := range assign.Lhs {
+			if blank(lhs) && isError(tuple.At(i).Type()) {
+				w.add(&w.surface.Ignored, call)
+				return
+			}
+		}
+		return
+	}
+	for i, lhs := range assign.Lhs {
+		if i >= len(assign.Rhs) {
+			break
+		}
+		call, ok := assign.Rhs[i].(*ast.CallExpr)
+		if ok && blank(lhs) && isError(w.info.TypeOf(call)) {
+			w.add(&w.surface.Ignored, call)
+		}
+	}
+}
+
+// dropsError reports whether a call used as a statement returns an error
+// nobody looks at.
+func (w *errorWalker) dropsError(call *ast.CallExpr) bool {
+	callee := resolveCall(w.info, call).Callee
+	for _, prefix := range uncheckedCalls {
+		if strings.HasPrefix(callee, prefix) {
+			return false
+		}
+	}
+	switch t := w.info.TypeOf(call).(type) {
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			if isError(t.At(i).Type()) {
+				return true
+			}
+		}
+		return false
+	default:
+		return isError(t)
+	}
+}
+
+// shorten cuts text to at most n runes, marking the cut with an ellipsis.
+func shorten(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// Empty reports whether the package neither produces nor handles errors.
+func (s *ErrorSurface) Empty() bool {
+	return len(s.Returning)+len(s.Sentinels)+len(s.Types)+len(s.Wrapped)+
+		len(s.Checked)+len(s.Ignored)+len(s.Fatal) == 0
+}
+
+// ErrorSurfaceMarkdown renders the "Error surface" section of a package
+// note.
+func ErrorSurfaceMarkdown(pkg *PackageResult, noteDir string) string {
+	s := pkg.ErrorSurface
+	if s == nil || s.Empty() {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("## Error surface\n")
+
+	items := func(title string, items []Item) {
+		if len(items) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n", title)
+		for _, item := range items {
+			fmt.Fprintf(&b, "- `%s` %s\n", item.Name, Link(item.Position, noteDir))
+		}
+	}
+	uses := func(title string, uses []ErrorUse) {
+		if len(uses) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n", title)
+		b.WriteString("| Function | Call | Location |\n")
+		b.WriteString("| --- | --- | --- |\n")
+		for _, use := range uses {
+			call := strings.ReplaceAll(use.Call, "|", `\|`)
+			fmt.Fprintf(&b, "| `%s` | `%s` | %s |\n", use.Function, call, Link(use.Position, noteDir))
+		}
+	}
+	items("Functions returning errors", s.Returning)
+	items("Sentinel errors", s.Sentinels)
+	items("Error types", s.Types)
+	uses("Wrapping", s.Wrapped)
+	uses("errors.Is / errors.As", s.Checked)
+	uses("Ignored errors", s.Ignored)
+	uses("Fatal error handling", s.Fatal)
+	return b.String()
+}
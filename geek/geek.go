@@ -1,232 +1,229 @@
 package geek
 
 import (
-	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go/scanner"
+	"go/token"
+	"io/fs"
 	"os"
-	"path/filepath"
-	"regexp"
+	"strings"
 )
 
 // Create a struct to hold analysis results
 type AnalysisResult struct {
-	PackageName     string   `json:"packageName"`
-	Imports         []string `json:"imports"`
-	Structs         []string `json:"structs"`
-	Variables       []string `json:"variables"`
-	Constants       []string `json:"constants"`
-	Comments        []string `json:"comments"`
-	Interfaces      []string `json:"interfaces"`
-	Methods         []string `json:"methods"`
-	Channels        []string `json:"channels"`
-	ErrorHandling   []string `json:"errorHandling"`
-	TypeAssertions  []string `json:"typeAssertions"`
-	ControlFlow     []string `json:"controlFlow"`
-	DeferStatements []string `json:"deferStatements"`
-	PanicRecover    []string `json:"panicRecover"`
-	FunctionCalls   []string `json:"functionCalls"`
+	SchemaVersion   int          `json:"schemaVersion"`
+	PackageName     string       `json:"packageName"`
+	Imports         []Item       `json:"imports"`
+	Structs         []Item       `json:"structs"`
+	Variables       []Item       `json:"variables"`
+	Constants       []Item       `json:"constants"`
+	Comments        []Comment    `json:"comments"`
+	Interfaces      []Item       `json:"interfaces"`
+	Methods         []Item       `json:"methods"`
+	Channels        []Item       `json:"channels"`
+	ErrorHandling   []Assignment `json:"errorHandling"`
+	TypeAssertions  []Item       `json:"typeAssertions"`
+	ControlFlow     []Item       `json:"controlFlow"`
+	DeferStatements []Item       `json:"deferStatements"`
+	PanicRecover    []Item       `json:"panicRecover"`
+	FunctionCalls   []Item       `json:"functionCalls"`
+	SyntaxErrors    []string     `json:"syntaxErrors,omitempty"`
+
+	Declarations []Declaration `json:"declarations"`
+	Concurrency  *Concurrency  `json:"concurrency,omitempty"`
+	Metrics      *FileMetrics  `json:"metrics,omitempty"`
 }
 
-func removeDuplicates[T comparable](input []T) []T {
-    encountered := map[T]bool{}
-    result := []T{}
-
-    for _, value := range input {
-        if !encountered[value] {
-            encountered[value] = true
-            result = append(result, value)
-        }
-    }
-
-    return result
+// Declaration describes a function or method declared in a file.
+type Declaration struct {
+	Name            string   `json:"name"`
+	Receiver        string   `json:"receiver,omitempty"`
+	PointerReceiver bool     `json:"pointerReceiver,omitempty"`
+	TypeParams      []Param  `json:"typeParams,omitempty"`
+	Params          []Param  `json:"params"`
+	Results         []Param  `json:"results"`
+	Exported        bool     `json:"exported"`
+	Doc             string   `json:"doc,omitempty"`
+	Start           Position `json:"start"`
+	End             Position `json:"end"`
 }
 
-func Run(filePath string) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error opening file:", err)
-		return
-	}
-	defer file.Close()
-
-	// Specify the target file path in the same directory with a different filename
-	targetFileName := filePath+ ".json"
-	targetFilePath := filepath.Join(filepath.Dir(filePath), targetFileName)
-
-	importRegex := regexp.MustCompile(`^\s*import\s+\(\s*"([^"]+)"\s*\)`)
-	var imports []string
-	commentRegex := regexp.MustCompile(`^\s*\/\/(.*)|^\s*\/\*([^*]*\*\/)`)
-	structRegex := regexp.MustCompile(`^\s*type\s+([a-zA-Z_]\w*)\s+struct\s*{`)
-	varRegex := regexp.MustCompile(`var\s+([a-zA-Z_]\w*)\s+([a-zA-Z_]\w*)`)
-	constRegex := regexp.MustCompile(`const\s+([a-zA-Z_]\w*)\s+([a-zA-Z_]\w*)`)
-	interfaceRegex := regexp.MustCompile(`type\s+([a-zA-Z_]\w*)\s+interface\s*{`)
-	methodRegex := regexp.MustCompile(`func\s+\(([a-zA-Z_]\w*)\s*\*?([a-zA-Z_]\w*)\)\s*([a-zA-Z_]\w*)\(`)
-	channelRegex := regexp.MustCompile(`(make\()?(chan<-[^\s]*)`)
-	packageRegex := regexp.MustCompile(`^package\s+([a-zA-Z_]\w*)`)
-	errorHandlingRegex := regexp.MustCompile(`(\w+),\s*(\w+)\s*:=\s*(\w+)\(.*\)`)
-	typeAssertionRegex := regexp.MustCompile(`([a-zA-Z_]\w*)\s*:=\s*\(([^)]+)\)`)
-	controlFlowRegex := regexp.MustCompile(`(if|else|switch|case|default|select)\s*{`)
-	deferRegex := regexp.MustCompile(`defer\s+([a-zA-Z_]\w*)\(`)
-	panicRecoverRegex := regexp.MustCompile(`(panic|recover)\(.*\)`)
-	functionCallRegex := regexp.MustCompile(`([a-zA-Z_]\w*)\(`)
-
-	var (
-		structs         []string
-		variables       []string
-		constants       []string
-		comments        []string
-		interfaces      []string
-		methods         []string
-		channels        []string
-		packageName     string
-		errorHandling   []string
-		typeAssertions  []string
-		controlFlow     []string
-		deferStatements []string
-		panicRecover    []string
-		functionCalls   []string
-	)
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-
-		if match := importRegex.FindStringSubmatch(line); len(match) > 1 {
-			imports = append(imports, match[1])
-		}
-
-		if match := commentRegex.FindStringSubmatch(line); len(match) > 0 {
-			comments = append(comments, match[1])
-		}
-
-		// Check for imports
-		if match := importRegex.FindStringSubmatch(line); len(match) > 1 {
-			imports = append(imports, match[1])
-		}
-
-		// Check for structs
-		if match := structRegex.FindStringSubmatch(line); len(match) > 1 {
-			structs = append(structs, match[1])
-		}
-
-		// Check for variables
-		if match := varRegex.FindStringSubmatch(line); len(match) > 2 {
-			variables = append(variables, match[2])
-		}
+// Param is a parameter, result or type parameter. Unnamed parameters have
+// an empty Name; variadic parameters have a Type starting with "...".
+type Param struct {
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+}
 
-		// Check for constants
-		if match := constRegex.FindStringSubmatch(line); len(match) > 2 {
-			constants = append(constants, match[2])
-		}
+// Position is a place in a source file. Line and Column start at 1.
+type Position struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
 
-		// Check for comments
-		if match := commentRegex.FindStringSubmatch(line); len(match) > 0 {
-			comments = append(comments, match[1])
-		}
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
 
-		// Check for interfaces
-		if match := interfaceRegex.FindStringSubmatch(line); len(match) > 1 {
-			interfaces = append(interfaces, match[1])
-		}
+// Item is a named thing found in a file, such as an import or a call.
+type Item struct {
+	Name string `json:"name"`
+	Position
+}
 
-		// Check for channels
-		if match := channelRegex.FindStringSubmatch(line); len(match) > 1 {
-			channels = append(channels, match[2])
-		}
+// Assignment is a multi-value assignment from a single call, such as
+// `data, err := os.ReadFile(path)`.
+type Assignment struct {
+	Targets []string `json:"targets"`
+	Call    string   `json:"call"`
+	Position
+}
 
-		// Check for package name
-		if match := packageRegex.FindStringSubmatch(line); len(match) > 1 {
-			packageName = match[1]
-		}
+// Comment is the text of a comment group.
+type Comment struct {
+	Text string `json:"text"`
+	Position
+}
 
-		// Check for error handling
-		if match := errorHandlingRegex.FindStringSubmatch(line); len(match) > 2 {
-			errorHandling = append(errorHandling, match[1], match[2], match[3])
-		}
+// QualifiedName is "Name" for functions and "Receiver.Name" for methods.
+func (d Declaration) QualifiedName() string {
+	if d.Receiver == "" {
+		return d.Name
+	}
+	return d.Receiver + "." + d.Name
+}
 
-		// Check for type assertions
-		if match := typeAssertionRegex.FindStringSubmatch(line); len(match) > 1 {
-			typeAssertions = append(typeAssertions, match[1])
+// Signature renders the declaration as Go source, without a body.
+func (d Declaration) Signature() string {
+	var b strings.Builder
+	b.WriteString("func ")
+	if d.Receiver != "" {
+		b.WriteString("(")
+		if d.PointerReceiver {
+			b.WriteString("*")
 		}
+		b.WriteString(d.Receiver + ") ")
+	}
+	b.WriteString(d.Name)
+	if len(d.TypeParams) > 0 {
+		b.WriteString("[" + joinParams(d.TypeParams) + "]")
+	}
+	b.WriteString("(" + joinParams(d.Params) + ")")
+	switch {
+	case len(d.Results) == 1 && d.Results[0].Name == "":
+		b.WriteString(" " + d.Results[0].Type)
+	case len(d.Results) > 0:
+		b.WriteString(" (" + joinParams(d.Results) + ")")
+	}
+	return b.String()
+}
 
-		// Check for control flow statements
-		if match := controlFlowRegex.FindStringSubmatch(line); len(match) > 0 {
-			controlFlow = append(controlFlow, match[1])
-		}
+func joinParams(params []Param) string {
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = strings.TrimSpace(p.Name + " " + p.Type)
+	}
+	return strings.Join(parts, ", ")
+}
 
-		// Check for defer statements
-		if match := deferRegex.FindStringSubmatch(line); len(match) > 1 {
-			deferStatements = append(deferStatements, match[1])
-		}
+func removeDuplicates[T comparable](input []T) []T {
+	encountered := map[T]bool{}
+	result := []T{}
 
-		// Check for panic/recover statements
-		if match := panicRecoverRegex.FindStringSubmatch(line); len(match) > 0 {
-			panicRecover = append(panicRecover, match[1])
+	for _, value := range input {
+		if !encountered[value] {
+			encountered[value] = true
+			result = append(result, value)
 		}
+	}
 
-		// Check for methods
-if match := methodRegex.FindStringSubmatch(line); len(match) > 2 {
-    methods = append(methods, match[1]+"."+match[3]) // Assuming you want the full method name with the struct/interface name
+	return result
 }
 
-// Check for function calls
-if match := functionCallRegex.FindStringSubmatch(line); len(match) > 1 {
-    functionCalls = append(functionCalls, match[1])
+// Options control how a file is analyzed.
+type Options struct {
+	// Filename is the name reported in positions. It defaults to the path
+	// or name the source was read from.
+	Filename string
+
+	// Strict makes syntax errors fail the analysis. By default they are
+	// recorded in SyntaxErrors and whatever could be parsed is analyzed.
+	Strict bool
 }
 
+// Analyze parses and analyzes the Go file at path.
+func Analyze(path string, opts Options) (*AnalysisResult, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
-
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintln(os.Stderr, "Error reading file:", err)
-		return
+	if opts.Filename == "" {
+		opts.Filename = path
 	}
+	return AnalyzeSource(path, src, opts)
+}
 
-// Usage
-result := AnalysisResult{
-    PackageName:     packageName,
-    Imports:         removeDuplicates(imports),
-    Structs:         removeDuplicates(structs),
-    Variables:       removeDuplicates(variables),
-    Constants:       removeDuplicates(constants),
-    Comments:        removeDuplicates(comments),
-    Interfaces:      removeDuplicates(interfaces),
-    Methods:         removeDuplicates(methods),
-    Channels:        removeDuplicates(channels),
-    ErrorHandling:   removeDuplicates(errorHandling),
-    TypeAssertions:  removeDuplicates(typeAssertions),
-    ControlFlow:     removeDuplicates(controlFlow),
-    DeferStatements: removeDuplicates(deferStatements),
-    PanicRecover:    removeDuplicates(panicRecover),
-    FunctionCalls:   removeDuplicates(functionCalls),
-}
-	// Create or open the target file
-	targetFile, err := os.Create(targetFilePath)
+// AnalyzeFS analyzes the Go file called name in fsys.
+func AnalyzeFS(fsys fs.FS, name string, opts Options) (*AnalysisResult, error) {
+	src, err := fs.ReadFile(fsys, name)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error creating file:", err)
-		return
+		return nil, err
 	}
-	defer targetFile.Close()
+	return AnalyzeSource(name, src, opts)
+}
 
+// AnalyzeSource analyzes Go source held in memory. filename is only used
+// for positions and error messages, unless opts.Filename overrides it.
+func AnalyzeSource(filename string, src []byte, opts Options) (*AnalysisResult, error) {
+	if opts.Filename == "" {
+		opts.Filename = filename
+	}
 
+	// Parse the whole file so that grouped declarations and multi-line
+	// import blocks are seen as a unit. Files that don't compile still
+	// give back whatever declarations could be recovered.
+	fset := token.NewFileSet()
+	file, err := parseFile(fset, opts.Filename, src)
+	if file == nil {
+		return nil, err
+	}
+	if err != nil && opts.Strict {
+		return nil, err
+	}
 
-	
-// Convert the result to JSON
-resultJSON, err := json.MarshalIndent(result, "", "  ")
-if err != nil {
-    fmt.Fprintln(os.Stderr, "Error marshalling result to JSON:", err)
-    return
+	result := analyzeFile(fset, file, opts.Filename)
+	var syntaxErrors scanner.ErrorList
+	if errors.As(err, &syntaxErrors) {
+		for _, e := range syntaxErrors {
+			result.SyntaxErrors = append(result.SyntaxErrors, e.Error())
+		}
+	}
+	return &result, nil
 }
 
-// Write the JSON to the target file
-_, err = targetFile.Write(resultJSON)
-if err != nil {
-    fmt.Fprintln(os.Stderr, "Error writing JSON to file:", err)
-    return
+// JSONPath is where the analysis of a source file is written by default:
+// next to it, with ".json" appended to its name.
+func JSONPath(sourcePath string) string {
+	return sourcePath + ".json"
 }
 
-// Close the file and print a message
-fmt.Println("Analysis result written to", targetFilePath)
+// WriteJSON writes an analysis to path as indented JSON.
+func WriteJSON(result *AnalysisResult, path string) error {
+	resultJSON, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(resultJSON, '\n'), 0644)
+}
 
-	fmt.Println(result)
+// Run analyzes a file and writes the result next to it, see JSONPath.
+func Run(filePath string) error {
+	result, err := Analyze(filePath, Options{})
+	if err != nil {
+		return err
+	}
+	return WriteJSON(result, JSONPath(filePath))
 }
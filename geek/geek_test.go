@@ -0,0 +1,673 @@
+package geek
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// TestGolden analyzes every testdata/*.go file and compares the result with
+// the matching .golden.json file. Run with -update to regenerate them.
+func TestGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no testdata inputs found")
+	}
+
+	for _, input := range inputs {
+		input := input
+		name := strings.TrimSuffix(filepath.Base(input), ".go")
+		t.Run(name, func(t *testing.T) {
+			result, err := Analyze(input, Options{Filename: filepath.Base(input)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.MarshalIndent(result, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := filepath.Join("testdata", name+".golden.json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("reading golden file: %v (run go test -update)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("analysis of %s does not match %s\n--- got\n%s\n--- want\n%s", input, golden, got, want)
+			}
+		})
+	}
+}
+
+func TestIsCodeLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"Check for imports", false},
+		{"Usage", false},
+		{"Run geek.Run(filepath) after processing the file", false},
+		{"func processFile(path string, info os.FileInfo, err error) error {", true},
+		{"if err != nil {", true},
+		{"return err", true},
+		{"return nil", true},
+		{"}", true},
+		{`fmt.Printf("Copying %s to %s\n", path, mdFilename)`, true},
+	}
+	for _, tt := range tests {
+		if got := isCodeLine(tt.line); got != tt.want {
+			t.Errorf("isCodeLine(%q) = %v, want %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestAnalyzePackages(t *testing.T) {
+	results, err := AnalyzePackages(filepath.Join("testdata", "typed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d packages, want 1", len(results))
+	}
+	pkg := results[0]
+	if pkg.Path != "example.com/typed" {
+		t.Errorf("package path = %q", pkg.Path)
+	}
+	if _, ok := pkg.Files["shapes.go"]; !ok {
+		t.Errorf("per-file results missing shapes.go: %v", pkg.Files)
+	}
+
+	types := map[string]TypeInfo{}
+	for _, info := range pkg.Types {
+		types[info.Name] = info
+	}
+	implements := func(name, iface string) (found, pointer bool) {
+		for _, impl := range types[name].Implements {
+			if impl.Interface == iface {
+				return true, impl.Pointer
+			}
+		}
+		return false, false
+	}
+	if found, pointer := implements("Square", "Shape"); !found || !pointer {
+		t.Errorf("Square should implement Shape through a pointer: %+v", types["Square"].Implements)
+	}
+	if found, pointer := implements("Circle", "Shape"); !found || pointer {
+		t.Errorf("Circle should implement Shape as a value: %+v", types["Circle"].Implements)
+	}
+	if found, _ := implements("Square", "fmt.Stringer"); !found {
+		t.Errorf("Square should implement fmt.Stringer via embedded Base: %+v", types["Square"].Implements)
+	}
+	if got := types["Square"].Embeds; len(got) != 1 || got[0] != "Base" {
+		t.Errorf("Square embeds = %v", got)
+	}
+
+	kinds := map[string]string{}
+	for _, call := range pkg.Calls {
+		kinds[call.Callee] = call.Kind
+	}
+	want := map[string]string{
+		"(example.com/typed.Shape).Area": CallInterface,
+		"fmt.Println":                    CallFunction,
+		"len":                            CallBuiltin,
+		"float64":                        CallConversion,
+	}
+	for callee, kind := range want {
+		if kinds[callee] != kind {
+			t.Errorf("call to %s has kind %q, want %q (all: %v)", callee, kinds[callee], kind, kinds)
+		}
+	}
+}
+
+func TestDeclarationSignature(t *testing.T) {
+	decl := Declaration{
+		Name:            "Map",
+		Receiver:        "List",
+		PointerReceiver: true,
+		TypeParams:      []Param{{Name: "U", Type: "any"}},
+		Params:          []Param{{Name: "fn", Type: "func(T) U"}, {Name: "opts", Type: "...Option"}},
+		Results:         []Param{{Type: "*List[U]"}, {Type: "error"}},
+	}
+	want := "func (*List) Map[U any](fn func(T) U, opts ...Option) (*List[U], error)"
+	if got := decl.Signature(); got != want {
+		t.Errorf("Signature() = %q, want %q", got, want)
+	}
+	if got := decl.QualifiedName(); got != "List.Map" {
+		t.Errorf("QualifiedName() = %q", got)
+	}
+}
+
+func TestLink(t *testing.T) {
+	pos := Position{File: filepath.Join("notes", "my pkg", "file.go"), Line: 42}
+	want := "[my pkg/file.go:42](my%20pkg/file.go#L42)"
+	if got := Link(pos, "notes"); got != want {
+		t.Errorf("Link() = %q, want %q", got, want)
+	}
+}
+
+// TestSchemaUpToDate keeps the published schema in sync with the Go types.
+func TestSchemaUpToDate(t *testing.T) {
+	got, err := JSONSchema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *update {
+		if err := os.WriteFile("analysis.schema.json", got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile("analysis.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("analysis.schema.json is out of date, run go test -update")
+	}
+}
+
+func TestReadLegacyResult(t *testing.T) {
+	result, err := LoadResult(filepath.Join("testdata", "legacy", "v1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SchemaVersion != SchemaVersion {
+		t.Errorf("migrated schemaVersion = %d", result.SchemaVersion)
+	}
+	if len(result.Structs) != 1 || result.Structs[0].Name != "Message" {
+		t.Errorf("structs = %+v", result.Structs)
+	}
+	if len(result.Comments) == 0 || result.Comments[0].Text == "" {
+		t.Errorf("comments were not migrated: %+v", result.Comments)
+	}
+	if len(result.ErrorHandling) == 0 || result.ErrorHandling[0].Targets[0] != "gitignorePath" {
+		t.Errorf("errorHandling = %+v", result.ErrorHandling)
+	}
+}
+
+func TestReadCurrentResult(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "basic.golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := ReadResult(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(again, '\n'), data) {
+		t.Error("reading and re-encoding a current result changed it")
+	}
+
+	if _, err := ReadResult(strings.NewReader(`{"schemaVersion": 99}`)); err == nil {
+		t.Error("expected an error for a newer schema version")
+	}
+}
+
+func TestAnalyzeFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pkg/a.go": {Data: []byte("package pkg\n\nfunc A() {}\n")},
+	}
+	result, err := AnalyzeFS(fsys, "pkg/a.go", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Declarations) != 1 || result.Declarations[0].Start.File != "pkg/a.go" {
+		t.Errorf("declarations = %+v", result.Declarations)
+	}
+
+	if _, err := AnalyzeSource("bad.go", []byte("package bad\nfunc {"), Options{Strict: true}); err == nil {
+		t.Error("strict analysis of a broken file should fail")
+	}
+	result, err = AnalyzeSource("bad.go", []byte("package bad\nfunc {"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.SyntaxErrors) == 0 {
+		t.Error("syntax errors should be recorded in lenient mode")
+	}
+
+	// Source held in memory is analyzed even when empty, not read from
+	// the file it is named after
+	result, err = AnalyzeSource("geek.go", nil, Options{})
+	if err == nil && len(result.Declarations) > 0 {
+		t.Errorf("empty source has declarations: %+v", result.Declarations)
+	}
+}
+
+func TestBuildImportGraph(t *testing.T) {
+	dir := filepath.Join("testdata", "layered")
+	layers, err := LoadLayers(filepath.Join(dir, ".documentor.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := BuildImportGraph(dir, GraphOptions{Layers: layers})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if graph.Module != "example.com/layered" || len(graph.Packages) != 4 {
+		t.Fatalf("unexpected graph: %+v", graph)
+	}
+
+	classes := map[string]Import{}
+	for _, pkg := range graph.Packages {
+		for _, imp := range pkg.Imports {
+			classes[imp.Path] = imp
+		}
+	}
+	if classes["fmt"].Class != ImportStdlib {
+		t.Errorf("fmt classified as %q", classes["fmt"].Class)
+	}
+	if imp := classes["example.org/dep/client"]; imp.Class != ImportThirdParty || imp.Module != "example.org/dep" {
+		t.Errorf("example.org/dep/client classified as %+v", imp)
+	}
+	if classes["example.com/layered/core"].Class != ImportInternal {
+		t.Errorf("core classified as %q", classes["example.com/layered/core"].Class)
+	}
+
+	wantCycle := []string{"example.com/layered/core", "example.com/layered/store"}
+	if len(graph.Cycles) != 1 || strings.Join(graph.Cycles[0], " ") != strings.Join(wantCycle, " ") {
+		t.Errorf("cycles = %v, want [%v]", graph.Cycles, wantCycle)
+	}
+
+	rules := map[string]bool{}
+	for _, v := range graph.Violations {
+		rules[v.Rule+" "+v.From+" -> "+v.To] = true
+	}
+	for _, want := range []string{
+		"layer example.com/layered/store -> example.com/layered/core",
+		"internal-import example.com/layered/store -> example.com/layered/core/internal/secret",
+	} {
+		if !rules[want] {
+			t.Errorf("missing violation %q in %v", want, rules)
+		}
+	}
+
+	if !strings.Contains(graph.Mermaid(), "-.->") || !strings.Contains(graph.DOT(), "style=dashed") {
+		t.Error("third-party edges missing from diagrams")
+	}
+}
+
+func TestBuildCallGraph(t *testing.T) {
+	graph, err := BuildCallGraph(filepath.Join("testdata", "calls"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edges := map[string]bool{}
+	for _, edge := range graph.Edges {
+		edges[fmt.Sprintf("%s -> %s %v", edge.Caller, edge.Callee, edge.Dynamic)] = true
+	}
+	for _, want := range []string{
+		"example.com/calls.Fetch -> (example.com/calls.Store).Get true",
+		"example.com/calls.Fetch -> (example.com/calls.memory).Get true",
+		"example.com/calls.Fetch -> each (func value) true",
+		"(example.com/calls.memory).Get -> example.com/calls.lookup false",
+		"example.com/calls.lookup -> fmt.Sprint false",
+	} {
+		if !edges[want] {
+			t.Errorf("missing edge %q", want)
+		}
+	}
+
+	entries := map[string][]string{}
+	for _, fn := range graph.EntryPoints() {
+		entries[fn.Name] = fn.Entry
+	}
+	if got := entries["calls.Fetch"]; len(got) != 1 || got[0] != EntryExported {
+		t.Errorf("Fetch entry = %v", got)
+	}
+	if got := entries["calls.handle"]; len(got) != 1 || got[0] != EntryHTTPHandler {
+		t.Errorf("handle entry = %v", got)
+	}
+	if _, ok := entries["calls.memory.Get"]; ok {
+		t.Error("methods of unexported types are not exported entry points")
+	}
+
+	chart := graph.CallChainMermaid("example.com/calls.handle", 1)
+	if !strings.Contains(chart, "calls.Fetch") || strings.Contains(chart, "calls.lookup") {
+		t.Errorf("depth limit not applied:\n%s", chart)
+	}
+	if !strings.Contains(chart, "…") {
+		t.Errorf("truncated chains should be marked:\n%s", chart)
+	}
+}
+
+func TestFunctionMetrics(t *testing.T) {
+	src := `package m
+
+func classify(n int, ok bool) (string, error) {
+	if n < 0 && ok {
+		return "negative", nil
+	} else if n == 0 {
+		return "zero", nil
+	}
+	for i := 0; i < n; i++ {
+		if i%2 == 0 || i%3 == 0 && ok {
+			continue
+		}
+	}
+	switch {
+	case n > 100:
+		return "big", nil
+	default:
+		return "small", nil
+	}
+}
+`
+	result, err := AnalyzeSource("m.go", []byte(src), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Metrics == nil || len(result.Metrics.Functions) != 1 {
+		t.Fatalf("metrics = %+v", result.Metrics)
+	}
+	got := result.Metrics.Functions[0]
+	// if, &&, else if, for, if, ||, &&, case
+	if got.Cyclomatic != 9 {
+		t.Errorf("cyclomatic = %d, want 9", got.Cyclomatic)
+	}
+	// if 1 + && 1 + else if 1 + for 1 + nested if 2 + || && 2 + switch 1
+	if got.Cognitive != 9 {
+		t.Errorf("cognitive = %d, want 9", got.Cognitive)
+	}
+	if got.Nesting != 2 || got.Params != 2 || got.Results != 2 || got.LinesOfCode != 18 {
+		t.Errorf("metrics = %+v", got)
+	}
+	if got.Maintainability <= 0 || got.Maintainability >= 100 {
+		t.Errorf("maintainability = %v", got.Maintainability)
+	}
+}
+
+func TestErrorSurface(t *testing.T) {
+	results, err := AnalyzePackages(filepath.Join("testdata", "errflow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d packages, want 1", len(results))
+	}
+	s := results[0].ErrorSurface
+
+	names := func(items []Item) []string {
+		var result []string
+		for _, item := range items {
+			result = append(result, item.Name)
+		}
+		return result
+	}
+	calls := func(uses []ErrorUse) []string {
+		var result []string
+		for _, use := range uses {
+			result = append(result, use.Function+": "+use.Call)
+		}
+		return result
+	}
+	checks := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"returning", names(s.Returning), []string{"Get"}},
+		{"sentinels", names(s.Sentinels), []string{"ErrNotFound"}},
+		{"types", names(s.Types), []string{"*QueryError"}},
+		{"wrapped", calls(s.Wrapped), []string{`Get: fmt.Errorf("get %s: %w", key, ErrNotFound)`}},
+		{"checked", calls(s.Checked), []string{"Lookup: errors.Is(err, ErrNotFound)"}},
+		{"ignored", calls(s.Ignored), []string{"Cleanup: os.Remove(path)", "Cleanup: os.Chdir(path)"}},
+		{"fatal", calls(s.Fatal), []string{`Lookup: log.Fatalf("lookup: %v", err)`}},
+	}
+	for _, c := range checks {
+		if strings.Join(c.got, "\n") != strings.Join(c.want, "\n") {
+			t.Errorf("%s = %q, want %q", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestClassDiagram(t *testing.T) {
+	results, err := AnalyzePackages(filepath.Join("testdata", "typed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := results[0]
+
+	var canvas TypeInfo
+	for _, info := range pkg.Types {
+		if info.Name == "Canvas" {
+			canvas = info
+		}
+	}
+	if len(canvas.Fields) != 5 {
+		t.Fatalf("Canvas fields = %+v", canvas.Fields)
+	}
+	if origin := canvas.Fields[2]; origin.Type != "*Circle" || origin.Tags["json"] != "origin" || origin.Tags["db"] != "origin_id" {
+		t.Errorf("Origin field = %+v", origin)
+	}
+
+	diagram := pkg.ClassDiagram()
+	for _, want := range []string{
+		"  class Shape {\n    <<interface>>\n    +Area()\n  }",
+		"    +Title string\n",
+		"  Canvas o-- \"*\" Shape : Shapes\n",
+		"  Canvas o-- Circle : Origin\n",
+		"  Canvas o-- \"*\" Square : Layers\n",
+		"  Canvas *-- Circle : primary\n",
+		"  Square *-- Base : embeds\n",
+		"  Circle ..|> Shape : implements\n",
+	} {
+		if !strings.Contains(diagram, want) {
+			t.Errorf("class diagram lacks %q:\n%s", want, diagram)
+		}
+	}
+}
+
+func TestPayloads(t *testing.T) {
+	results, err := AnalyzePackages(filepath.Join("testdata", "typed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloads := map[string]Payload{}
+	for _, payload := range results[0].Payloads {
+		payloads[payload.Type] = payload
+	}
+	if _, ok := payloads["Circle"]; ok {
+		t.Error("Circle has no json tags and should not be a payload")
+	}
+	event, ok := payloads["Event"]
+	if !ok {
+		t.Fatalf("no payload for Event: %v", payloads)
+	}
+
+	wantSchema := `{"$schema":"https://json-schema.org/draft/2020-12/schema","title":"Event","type":"object",` +
+		`"properties":{"Name":{"type":"string"},"id":{"type":"string"},"at":{"type":"string","format":"date-time"},` +
+		`"labels":{"type":"object","additionalProperties":{"type":"string"}},"retries":{"type":"integer"},` +
+		`"data":{"type":"string","contentEncoding":"base64"},"origin":{"$ref":"#/$defs/Circle"}},` +
+		`"required":["Name","id","at","data","origin"],` +
+		`"$defs":{"Circle":{"type":"object","properties":{"Radius":{"type":"number"}},"required":["Radius"]}}}`
+	if string(event.Schema) != wantSchema {
+		t.Errorf("schema =\n%s\nwant\n%s", event.Schema, wantSchema)
+	}
+	wantExample := `{"Name":"example","id":"3f2b8c1e-5d4a-4e2b-9c7d-1a2b3c4d5e6f","at":"2024-01-02T15:04:05Z",` +
+		`"labels":{"key":"example"},"retries":42,"data":"ZXhhbXBsZQ==","origin":{"Radius":3.14}}`
+	if string(event.Example) != wantExample {
+		t.Errorf("example =\n%s\nwant\n%s", event.Example, wantExample)
+	}
+
+	// Structs of the same name from different packages get their own
+	// definitions
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":  "module example.com/pair\n\ngo 1.21\n",
+		"a/a.go":  "package a\n\ntype Point struct {\n\tX int `json:\"x\"`\n}\n",
+		"pair.go": "package pair\n\nimport \"example.com/pair/a\"\n\ntype Point struct {\n\tY string `json:\"y\"`\n}\n\ntype Pair struct {\n\tLocal  Point   `json:\"local\"`\n\tRemote a.Point `json:\"remote\"`\n}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if results, err = AnalyzePackages(dir); err != nil {
+		t.Fatal(err)
+	}
+	var pair *Payload
+	for _, pkg := range results {
+		for i := range pkg.Payloads {
+			if pkg.Payloads[i].Type == "Pair" {
+				pair = &pkg.Payloads[i]
+			}
+		}
+	}
+	if pair == nil {
+		t.Fatal("no payload for Pair")
+	}
+	wantSchema = `{"$schema":"https://json-schema.org/draft/2020-12/schema","title":"Pair","type":"object",` +
+		`"properties":{"local":{"$ref":"#/$defs/Point"},"remote":{"$ref":"#/$defs/example.com~1pair~1a.Point"}},` +
+		`"required":["local","remote"],` +
+		`"$defs":{"Point":{"type":"object","properties":{"y":{"type":"string"}},"required":["y"]},` +
+		`"example.com/pair/a.Point":{"type":"object","properties":{"x":{"type":"integer"}},"required":["x"]}}}`
+	if string(pair.Schema) != wantSchema {
+		t.Errorf("schema =\n%s\nwant\n%s", pair.Schema, wantSchema)
+	}
+}
+
+func TestEnumsAndStateMachines(t *testing.T) {
+	results, err := AnalyzePackages(filepath.Join("testdata", "typed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := results[0]
+
+	var got []string
+	for _, enum := range pkg.Enums {
+		for _, value := range enum.Values {
+			got = append(got, fmt.Sprintf("%s.%s=%s %q %v", enum.Type, value.Name, value.Value, value.Label, enum.Stringer))
+		}
+	}
+	want := []string{
+		`Level.Low="low" "LOW" true`,
+		`Level.High="high" "HIGH" true`,
+		`Mode.Debug="debug" "" true`,
+		`Mode.Verbose="verbose" "" true`,
+		`Ratio.Half=1/2 "" true`,
+		`Ratio.Full=1 "" true`,
+		`State.Idle=0 "idle" true`,
+		`State.Running=1 "running" true`,
+		`State.Stopped=2 "stopped" true`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("enums =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if len(pkg.States) != 1 {
+		t.Fatalf("state machines = %+v", pkg.States)
+	}
+	wantDiagram := "stateDiagram-v2\n" +
+		"  [*] --> Idle\n" +
+		"  Idle --> Running\n" +
+		"  Running --> Stopped\n" +
+		"  Stopped --> Idle\n"
+	if diagram := pkg.States[0].StateDiagram(); diagram != wantDiagram {
+		t.Errorf("state diagram =\n%s\nwant\n%s", diagram, wantDiagram)
+	}
+}
+
+func TestAPIDiff(t *testing.T) {
+	api, err := ExtractAPI(filepath.Join("testdata", "typed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := api.Text()
+	for _, want := range []string{
+		"pkg example.com/typed, func Total func([]Shape) float64\n",
+		"pkg example.com/typed, method (*Square).Area func() float64\n",
+		"pkg example.com/typed, interface-method Shape.Area func() float64\n",
+		"pkg example.com/typed, field Canvas.Origin *Circle\n",
+		"pkg example.com/typed, const Running State = 1\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("snapshot lacks %q:\n%s", want, text)
+		}
+	}
+	parsed, err := ParseAPI(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Text() != text {
+		t.Errorf("text snapshot does not round-trip:\n%s", parsed.Text())
+	}
+
+	from, _ := ParseAPI(strings.NewReader(`pkg p, func Keep func(string) error
+pkg p, func Gone func()
+pkg p, func Change func(int)
+pkg p, const Limit untyped int = 10
+pkg p, type Store interface
+pkg p, interface-method Store.Get func(string) string
+`))
+	to, _ := ParseAPI(strings.NewReader(`pkg p, func Keep func(string) error
+pkg p, func Change func(int, int)
+pkg p, func Added func()
+pkg p, const Limit untyped int = 20
+pkg p, type Store interface
+pkg p, interface-method Store.Get func(string) string
+pkg p, interface-method Store.Put func(string, string)
+pkg p, type Cache interface
+pkg p, interface-method Cache.Get func(string) string
+`))
+	diff := DiffAPI(from, to)
+	lines := func(changes []APIChange) []string {
+		var result []string
+		for _, c := range changes {
+			result = append(result, c.Reason+": "+c.Old+" -> "+c.New)
+		}
+		return result
+	}
+	checks := []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"breaking", lines(diff.Breaking), []string{
+			"removed: pkg p, func Gone func() -> ",
+			"func changed: pkg p, func Change func(int) -> pkg p, func Change func(int, int)",
+			"method added to an interface; existing implementations no longer satisfy it:  -> pkg p, interface-method Store.Put func(string, string)",
+		}},
+		{"compatible", lines(diff.Compatible), []string{
+			"constant value changed: pkg p, const Limit untyped int = 10 -> pkg p, const Limit untyped int = 20",
+		}},
+		{"additions", lines(diff.Additions), []string{
+			"added:  -> pkg p, func Added func()",
+			"added:  -> pkg p, type Cache interface",
+			"added:  -> pkg p, interface-method Cache.Get func(string) string",
+		}},
+	}
+	for _, c := range checks {
+		if strings.Join(c.got, "\n") != strings.Join(c.want, "\n") {
+			t.Errorf("%s =\n%s\nwant\n%s", c.name, strings.Join(c.got, "\n"), strings.Join(c.want, "\n"))
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package geek
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Import classes
+const (
+	ImportStdlib     = "stdlib"
+	ImportInternal   = "internal"
+	ImportThirdParty = "third-party"
+)
+
+// ImportGraph is the package dependency graph of a module.
+type ImportGraph struct {
+	Module     string           `json:"module"`
+	Packages   []PackageImports `json:"packages"`
+	Cycles     [][]string       `json:"cycles"`
+	Violations []LayerViolation `json:"violations"`
+}
+
+// PackageImports lists what one package of the module imports.
+type PackageImports struct {
+	Path    string   `json:"path"`
+	Name    string   `json:"name"`
+	Dir     string   `json:"dir"`
+	Layer   string   `json:"layer,omitempty"`
+	Imports []Import `json:"imports"`
+}
+
+// Import is an imported package and where it comes from. Module is set for
+// third-party imports to the go.mod requirement that provides it, or left
+// empty when no requirement matches.
+type Import struct {
+	Path   string `json:"path"`
+	Class  string `json:"class"`
+	Module string `json:"module,omitempty"`
+}
+
+// LayerViolation is an import that breaks the module's layering.
+type LayerViolation struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Layer names a group of packages. Packages are matched by import path,
+// where a trailing "/..." matches the package and everything below it.
+type Layer struct {
+	Name     string   `json:"name"`
+	Packages []string `json:"packages"`
+}
+
+// GraphOptions configure BuildImportGraph.
+type GraphOptions struct {
+	// Layers are ordered from the top of the architecture down. A package
+	// may import packages in its own layer or below, never above.
+	Layers []Layer
+}
+
+// LoadLayers reads the "layers" section of a documentor config file.
+// A missing file means no layers are configured.
+func LoadLayers(path string) ([]Layer, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		Layers []Layer `json:"layers"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return config.Layers, nil
+}
+
+// BuildImportGraph collects the imports of every package in the module that
+// contains dir. Only import declarations are read, so it is cheap even for
+// large modules.
+func BuildImportGraph(dir string, opts GraphOptions) (*ImportGraph, error) {
+	l, err := newLoader(dir)
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := moduleDirs(l.root)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &ImportGraph{
+		Module:     l.mod.Module,
+		Packages:   []PackageImports{},
+		Cycles:     [][]string{},
+		Violations: []LayerViolation{},
+	}
+	for _, pkgDir := range dirs {
+		bp, err := l.ctxt.ImportDir(pkgDir, 0)
+		if err != nil {
+			continue
+		}
+		pkg := PackageImports{
+			Path:    l.importPath(pkgDir),
+			Name:    bp.Name,
+			Dir:     l.relPath(pkgDir),
+			Imports: []Import{},
+		}
+		pkg.Layer = layerOf(pkg.Path, opts.Layers)
+		for _, path := range bp.Imports {
+			pkg.Imports = append(pkg.Imports, l.classify(path))
+		}
+		graph.Packages = append(graph.Packages, pkg)
+	}
+
+	graph.Cycles = graph.findCycles()
+	graph.Violations = graph.findViolations(opts.Layers)
+	return graph, nil
+}
+
+// classify works out whether an import is from the standard library, the
+// module itself or a dependency.
+func (l *loader) classify(path string) Import {
+	if path == l.mod.Module || strings.HasPrefix(path, l.mod.Module+"/") {
+		return Import{Path: path, Class: ImportInternal}
+	}
+	if isStdlib(path) || path == "C" {
+		return Import{Path: path, Class: ImportStdlib}
+	}
+	imp := Import{Path: path, Class: ImportThirdParty}
+	for module := range l.mod.Requires {
+		if (path == module || strings.HasPrefix(path, module+"/")) && len(module) > len(imp.Module) {
+			imp.Module = module
+		}
+	}
+	return imp
+}
+
+func layerOf(path string, layers []Layer) string {
+	for _, layer := range layers {
+		for _, pattern := range layer.Packages {
+			if matchPackage(pattern, path) {
+				return layer.Name
+			}
+		}
+	}
+	return ""
+}
+
+func matchPackage(pattern, path string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/..."); ok {
+		return path == prefix || strings.HasPrefix(path, prefix+"/")
+	}
+	return pattern == path
+}
+
+// internalEdges maps each package to the module packages it imports.
+func (g *ImportGraph) internalEdges() map[string][]string {
+	edges := map[string][]string{}
+	for _, pkg := range g.Packages {
+		edges[pkg.Path] = nil
+		for _, imp := range pkg.Imports {
+			if imp.Class == ImportInternal {
+				edges[pkg.Path] = append(edges[pkg.Path], imp.Path)
+			}
+		}
+	}
+	return edges
+}
+
+// findCycles returns the strongly connected components of the internal
+// import graph that contain a cycle, using Tarjan's algorithm.
+func (g *ImportGraph) findCycles() [][]string {
+	edges := g.internalEdges()
+	index := map[string]int{}
+	lowlink := map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	cycles := [][]string{}
+
+	var strongConnect func(v string)
+	strongConnect = func(v string) {
+		index[v] = len(index)
+		lowlink[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range edges[v] {
+			if _, seen := index[w]; !seen {
+				strongConnect(w)
+				lowlink[v] = min(lowlink[v], lowlink[w])
+			} else if onStack[w] {
+				lowlink[v] = min(lowlink[v], index[w])
+			}
+		}
+
+		if lowlink[v] == index[v] {
+			var component []string
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				component = append(component, w)
+				if w == v {
+					break
+				}
+			}
+			selfLoop := false
+			for _, w := range edges[v] {
+				selfLoop = selfLoop || w == v
+			}
+			if len(component) > 1 || selfLoop {
+				sort.Strings(component)
+				cycles = append(cycles, component)
+			}
+		}
+	}
+
+	for _, pkg := range g.Packages {
+		if _, seen := index[pkg.Path]; !seen {
+			strongConnect(pkg.Path)
+		}
+	}
+	return cycles
+}
+
+// findViolations checks the go tool's own visibility rules, which still
+// matter for code that doesn't build yet, and the configured layers.
+func (g *ImportGraph) findViolations(layers []Layer) []LayerViolation {
+	rank := map[string]int{}
+	for i, layer := range layers {
+		rank[layer.Name] = i
+	}
+	names := map[string]string{}
+	pkgLayers := map[string]string{}
+	for _, pkg := range g.Packages {
+		names[pkg.Path] = pkg.Name
+		pkgLayers[pkg.Path] = pkg.Layer
+	}
+
+	violations := []LayerViolation{}
+	for _, pkg := range g.Packages {
+		for _, imp := range pkg.Imports {
+			if imp.Class != ImportInternal {
+				continue
+			}
+			if names[imp.Path] == "main" {
+				violations = append(violations, LayerViolation{
+					From: pkg.Path, To: imp.Path, Rule: "main-import",
+					Message: "main packages cannot be imported",
+				})
+			}
+			if parent, ok := internalParent(imp.Path); ok && !matchPackage(parent+"/...", pkg.Path) {
+				violations = append(violations, LayerViolation{
+					From: pkg.Path, To: imp.Path, Rule: "internal-import",
+					Message: fmt.Sprintf("internal package is only visible under %s", parent),
+				})
+			}
+
+			from, to := pkgLayers[pkg.Path], pkgLayers[imp.Path]
+			if from != "" && to != "" && rank[to] < rank[from] {
+				violations = append(violations, LayerViolation{
+					From: pkg.Path, To: imp.Path, Rule: "layer",
+					Message: fmt.Sprintf("layer %q must not depend on the higher layer %q", from, to),
+				})
+			}
+		}
+	}
+	return violations
+}
+
+// internalParent returns the directory that may import an internal package.
+func internalParent(path string) (string, bool) {
+	parts := strings.Split(path, "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if parts[i] == "internal" {
+			return strings.Join(parts[:i], "/"), true
+		}
+	}
+	return "", false
+}
+
+// thirdParty groups third-party imports by module and lists their users.
+func (g *ImportGraph) thirdParty() map[string][]string {
+	users := map[string][]string{}
+	for _, pkg := range g.Packages {
+		seen := map[string]bool{}
+		for _, imp := range pkg.Imports {
+			if imp.Class != ImportThirdParty {
+				continue
+			}
+			module := imp.Module
+			if module == "" {
+				module = imp.Path
+			}
+			if !seen[module] {
+				seen[module] = true
+				users[module] = append(users[module], pkg.Path)
+			}
+		}
+	}
+	return users
+}
+
+// nodeIDs gives every package and third-party module a diagram-safe ID.
+func (g *ImportGraph) nodeIDs() map[string]string {
+	ids := map[string]string{}
+	for i, pkg := range g.Packages {
+		ids[pkg.Path] = fmt.Sprintf("p%d", i)
+	}
+	for i, module := range sortedKeys(g.thirdParty()) {
+		ids[module] = fmt.Sprintf("m%d", i)
+	}
+	return ids
+}
+
+// Mermaid renders the module's packages and their third-party
+// dependencies as a Mermaid flowchart. Standard library imports are left
+// out to keep the diagram readable.
+func (g *ImportGraph) Mermaid() string {
+	ids := g.nodeIDs()
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	for _, pkg := range g.Packages {
+		fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[pkg.Path], pkg.Path)
+	}
+	thirdParty := g.thirdParty()
+	for _, module := range sortedKeys(thirdParty) {
+		fmt.Fprintf(&b, "  %s([\"%s\"])\n", ids[module], module)
+	}
+	for _, pkg := range g.Packages {
+		for _, imp := range pkg.Imports {
+			if imp.Class == ImportInternal && ids[imp.Path] != "" {
+				fmt.Fprintf(&b, "  %s --> %s\n", ids[pkg.Path], ids[imp.Path])
+			}
+		}
+	}
+	for _, module := range sortedKeys(thirdParty) {
+		for _, user := range thirdParty[module] {
+			fmt.Fprintf(&b, "  %s -.-> %s\n", ids[user], ids[module])
+		}
+	}
+	return b.String()
+}
+
+// DOT renders the same graph as Mermaid in Graphviz format.
+func (g *ImportGraph) DOT() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n", g.Module)
+	b.WriteString("  rankdir=LR;\n  node [shape=box];\n")
+	for _, pkg := range g.Packages {
+		fmt.Fprintf(&b, "  %q;\n", pkg.Path)
+	}
+	thirdParty := g.thirdParty()
+	for _, module := range sortedKeys(thirdParty) {
+		fmt.Fprintf(&b, "  %q [shape=ellipse];\n", module)
+	}
+	for _, pkg := range g.Packages {
+		for _, imp := range pkg.Imports {
+			if imp.Class == ImportInternal {
+				fmt.Fprintf(&b, "  %q -> %q;\n", pkg.Path, imp.Path)
+			}
+		}
+	}
+	for _, module := range sortedKeys(thirdParty) {
+		for _, user := range thirdParty[module] {
+			fmt.Fprintf(&b, "  %q -> %q [style=dashed];\n", user, module)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// ArchitectureMarkdown renders the repo-level architecture note.
+func (g *ImportGraph) ArchitectureMarkdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Architecture of %s\n\n", g.Module)
+	fmt.Fprintf(&b, "```mermaid\n%s```\n\n", g.Mermaid())
+
+	b.WriteString("## Packages\n\n")
+	b.WriteString("| Package | Layer | Internal | Third-party | Stdlib |\n")
+	b.WriteString("| --- | --- | --- | --- | --- |\n")
+	for _, pkg := range g.Packages {
+		counts := map[string]int{}
+		for _, imp := range pkg.Imports {
+			counts[imp.Class]++
+		}
+		layer := pkg.Layer
+		if layer == "" {
+			layer = "-"
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %d | %d | %d |\n", pkg.Path, layer,
+			counts[ImportInternal], counts[ImportThirdParty], counts[ImportStdlib])
+	}
+
+	thirdParty := g.thirdParty()
+	if len(thirdParty) > 0 {
+		b.WriteString("\n## Third-party dependencies\n\n")
+		for _, module := range sortedKeys(thirdParty) {
+			fmt.Fprintf(&b, "- `%s`, used by %s\n", module, codeList(thirdParty[module]))
+		}
+	}
+
+	if len(g.Cycles) > 0 {
+		b.WriteString("\n## Import cycles\n\n")
+		for _, cycle := range g.Cycles {
+			fmt.Fprintf(&b, "- %s\n", codeList(cycle))
+		}
+	}
+
+	if len(g.Violations) > 0 {
+		b.WriteString("\n## Layering violations\n\n")
+		for _, v := range g.Violations {
+			fmt.Fprintf(&b, "- `%s` imports `%s`: %s\n", v.From, v.To, v.Message)
+		}
+	}
+	return b.String()
+}
+
+func codeList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = "`" + item + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// WriteArchitecture writes the architecture note and the graph as Mermaid
+// (inside the note), DOT and JSON into dir.
+func (g *ImportGraph) WriteArchitecture(dir string) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	files := map[string][]byte{
+		"architecture.md":   []byte(g.ArchitectureMarkdown()),
+		"architecture.dot":  []byte(g.DOT()),
+		"architecture.json": append(data, '\n'),
+	}
+	for _, name := range sortedKeys(files) {
+		if err := os.WriteFile(filepath.Join(dir, name), files[name], 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,398 @@
+package geek
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// goMod holds the parts of a go.mod file the loader needs.
+type goMod struct {
+	Module   string
+	Requires map[string]string // module path -> version
+	Replaces map[string]string // module path -> local dir or "path@version"
+}
+
+// readGoMod parses the directives of a go.mod file that matter for
+// resolving imports. Anything it doesn't understand is skipped.
+func readGoMod(path string) (*goMod, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mod := &goMod{Requires: map[string]string{}, Replaces: map[string]string{}}
+	block := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if block != "" {
+			if fields[0] == ")" {
+				block = ""
+				continue
+			}
+			fields = append([]string{block}, fields...)
+		} else if len(fields) == 2 && fields[1] == "(" {
+			block = fields[0]
+			continue
+		}
+
+		switch fields[0] {
+		case "module":
+			if len(fields) > 1 {
+				mod.Module = strings.Trim(fields[1], `"`)
+			}
+		case "require":
+			if len(fields) > 2 {
+				mod.Requires[fields[1]] = fields[2]
+			}
+		case "replace":
+			// replace old [v] => new [v]
+			arrow := -1
+			for i, f := range fields {
+				if f == "=>" {
+					arrow = i
+				}
+			}
+			if arrow < 2 || arrow+1 >= len(fields) {
+				continue
+			}
+			target := fields[arrow+1]
+			if arrow+2 < len(fields) {
+				target += "@" + fields[arrow+2]
+			}
+			mod.Replaces[fields[1]] = target
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if mod.Module == "" {
+		return nil, fmt.Errorf("%s: no module directive", path)
+	}
+	return mod, nil
+}
+
+// ModuleRoot returns the root of the module containing dir. The paths in
+// the results of AnalyzePackages are relative to it.
+func ModuleRoot(dir string) (string, error) {
+	return findModuleRoot(dir)
+}
+
+// findModuleRoot walks up from dir to the nearest directory with a go.mod.
+func findModuleRoot(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("no go.mod found")
+		}
+		dir = parent
+	}
+}
+
+// loadedPackage is a parsed and type-checked package.
+type loadedPackage struct {
+	Path  string
+	Dir   string
+	Files []*ast.File
+	Types *types.Package
+	Info  *types.Info
+
+	// Errors collects type errors; they never stop the analysis
+	Errors []string
+}
+
+// loader type-checks packages from source. It never runs the go command or
+// touches the network: imports are found in the module itself, its vendor
+// directory, GOROOT or the local module cache, and anything it can't find
+// becomes an empty placeholder package.
+type loader struct {
+	fset     *token.FileSet
+	root     string
+	mod      *goMod
+	vendor   bool
+	modCache string
+	ctxt     build.Context
+
+	packages map[string]*loadedPackage // keyed by directory
+	loading  map[string]bool
+}
+
+func newLoader(dir string) (*loader, error) {
+	root, err := findModuleRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	mod, err := readGoMod(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return nil, err
+	}
+
+	modCache := os.Getenv("GOMODCACHE")
+	if modCache == "" {
+		gopath := strings.Split(build.Default.GOPATH, string(filepath.ListSeparator))[0]
+		modCache = filepath.Join(gopath, "pkg", "mod")
+	}
+
+	// Files that need cgo can't be type-checked without running cgo, so
+	// pick the pure Go variants instead
+	ctxt := build.Default
+	ctxt.CgoEnabled = false
+
+	_, err = os.Stat(filepath.Join(root, "vendor", "modules.txt"))
+	return &loader{
+		fset:     token.NewFileSet(),
+		root:     root,
+		mod:      mod,
+		vendor:   err == nil,
+		modCache: modCache,
+		ctxt:     ctxt,
+		packages: map[string]*loadedPackage{},
+		loading:  map[string]bool{},
+	}, nil
+}
+
+// importPath returns the import path of a directory inside the module.
+func (l *loader) importPath(dir string) string {
+	rel, err := filepath.Rel(l.root, dir)
+	if err != nil || rel == "." {
+		return l.mod.Module
+	}
+	return l.mod.Module + "/" + filepath.ToSlash(rel)
+}
+
+// isStdlib reports whether an import path belongs to the standard library.
+func isStdlib(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
+
+// resolve finds the directory for an import path seen in srcDir.
+func (l *loader) resolve(path, srcDir string) (string, bool) {
+	goroot := filepath.Join(l.ctxt.GOROOT, "src")
+
+	// The standard library vendors its own copies of golang.org/x packages
+	if strings.HasPrefix(srcDir, goroot+string(filepath.Separator)) {
+		if dir := filepath.Join(goroot, "vendor", path); isDir(dir) {
+			return dir, true
+		}
+	}
+	if path == l.mod.Module || strings.HasPrefix(path, l.mod.Module+"/") {
+		dir := filepath.Join(l.root, strings.TrimPrefix(path, l.mod.Module))
+		return dir, isDir(dir)
+	}
+
+	if isStdlib(path) {
+		dir := filepath.Join(goroot, path)
+		return dir, isDir(dir)
+	}
+
+	if l.vendor {
+		if dir := filepath.Join(l.root, "vendor", path); isDir(dir) {
+			return dir, true
+		}
+	}
+
+	// Longest required module that prefixes the import path
+	modules := make([]string, 0, len(l.mod.Requires))
+	for m := range l.mod.Requires {
+		modules = append(modules, m)
+	}
+	sort.Slice(modules, func(i, j int) bool { return len(modules[i]) > len(modules[j]) })
+	for _, m := range modules {
+		if path != m && !strings.HasPrefix(path, m+"/") {
+			continue
+		}
+		rel := strings.TrimPrefix(path, m)
+
+		var base string
+		if target, ok := l.mod.Replaces[m]; ok {
+			if strings.HasPrefix(target, ".") || filepath.IsAbs(target) {
+				base = target
+				if !filepath.IsAbs(base) {
+					base = filepath.Join(l.root, base)
+				}
+			} else {
+				modPath, version, _ := strings.Cut(target, "@")
+				base = filepath.Join(l.modCache, escapeModulePath(modPath)+"@"+version)
+			}
+		} else {
+			base = filepath.Join(l.modCache, escapeModulePath(m)+"@"+l.mod.Requires[m])
+		}
+		dir := filepath.Join(base, rel)
+		return dir, isDir(dir)
+	}
+	return "", false
+}
+
+// escapeModulePath applies the module cache's case encoding, where every
+// upper-case letter is written as '!' followed by the lower-case letter.
+func escapeModulePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// Import implements types.Importer.
+func (l *loader) Import(path string) (*types.Package, error) {
+	return l.ImportFrom(path, l.root, 0)
+}
+
+// ImportFrom implements types.ImporterFrom. Dependencies are checked without
+// function bodies since only their exported API matters.
+func (l *loader) ImportFrom(path, srcDir string, _ types.ImportMode) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	if path == "C" {
+		return placeholderPackage(path), nil
+	}
+
+	dir, ok := l.resolve(path, srcDir)
+	if !ok {
+		return placeholderPackage(path), nil
+	}
+	pkg, err := l.load(path, dir, false)
+	if err != nil || pkg.Types == nil {
+		return placeholderPackage(path), nil
+	}
+	return pkg.Types, nil
+}
+
+// placeholderPackage stands in for imports that can't be found offline.
+func placeholderPackage(path string) *types.Package {
+	name := path[strings.LastIndex(path, "/")+1:]
+	pkg := types.NewPackage(path, name)
+	pkg.MarkComplete()
+	return pkg
+}
+
+// load parses and type-checks the package in dir. Packages inside the module
+// are always checked in full; withBodies forces it for other packages.
+func (l *loader) load(path, dir string, withBodies bool) (*loadedPackage, error) {
+	if pkg, ok := l.packages[dir]; ok {
+		return pkg, nil
+	}
+	if l.loading[dir] {
+		return nil, fmt.Errorf("import cycle through %s", path)
+	}
+	l.loading[dir] = true
+	defer delete(l.loading, dir)
+
+	bp, err := l.ctxt.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := &loadedPackage{Path: path, Dir: dir}
+	for _, name := range bp.GoFiles {
+		filePath := filepath.Join(dir, name)
+		src, err := os.ReadFile(filePath)
+		if err != nil {
+			pkg.Errors = append(pkg.Errors, err.Error())
+			continue
+		}
+		file, err := parseFile(l.fset, filePath, src)
+		if file == nil {
+			pkg.Errors = append(pkg.Errors, err.Error())
+			continue
+		}
+		if err != nil {
+			pkg.Errors = append(pkg.Errors, err.Error())
+		}
+		pkg.Files = append(pkg.Files, file)
+	}
+
+	inModule := dir == l.root || strings.HasPrefix(dir, l.root+string(filepath.Separator))
+	full := withBodies || inModule
+	if full {
+		pkg.Info = &types.Info{
+			Types:      map[ast.Expr]types.TypeAndValue{},
+			Defs:       map[*ast.Ident]types.Object{},
+			Uses:       map[*ast.Ident]types.Object{},
+			Selections: map[*ast.SelectorExpr]*types.Selection{},
+			Implicits:  map[ast.Node]types.Object{},
+		}
+	}
+	conf := types.Config{
+		Importer:         l,
+		IgnoreFuncBodies: !full,
+		FakeImportC:      true,
+		Error: func(err error) {
+			if full {
+				pkg.Errors = append(pkg.Errors, err.Error())
+			}
+		},
+	}
+	pkg.Types, _ = conf.Check(path, l.fset, pkg.Files, pkg.Info)
+
+	l.packages[dir] = pkg
+	return pkg, nil
+}
+
+// moduleDirs lists every directory under dir that holds a Go package,
+// skipping vendor, testdata and hidden directories the way the go tool does.
+func moduleDirs(dir string) ([]string, error) {
+	var dirs []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		name := d.Name()
+		if path != dir && (name == "vendor" || name == "testdata" ||
+			strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+			return filepath.SkipDir
+		}
+		if path != dir {
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				// Nested modules are analyzed on their own
+				return filepath.SkipDir
+			}
+		}
+		matches, _ := filepath.Glob(filepath.Join(path, "*.go"))
+		if len(matches) > 0 {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	return dirs, err
+}
@@ -0,0 +1,117 @@
+package geek
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Link renders pos as a Markdown link relative to the directory a note is
+// written in, e.g. [rover.go:42](rover.go#L42). The #L anchor is what GitHub
+// uses for line links; Obsidian opens the file and ignores it.
+func Link(pos Position, noteDir string) string {
+	target := filepath.ToSlash(pos.File)
+	if rel, err := filepath.Rel(noteDir, pos.File); err == nil {
+		target = filepath.ToSlash(rel)
+	}
+	text := fmt.Sprintf("%s:%d", target, pos.Line)
+	href := (&url.URL{Path: target}).EscapedPath()
+	if pos.Line > 0 {
+		href += fmt.Sprintf("#L%d", pos.Line)
+	}
+	return fmt.Sprintf("[%s](%s)", text, href)
+}
+
+// SymbolsMarkdown renders the declarations, types and notable statements
+// of an analysis as a Markdown table with links back to the source.
+func SymbolsMarkdown(result *AnalysisResult, noteDir string) string {
+	var b strings.Builder
+	b.WriteString("## Symbols\n\n")
+	b.WriteString("| Symbol | Kind | Location |\n")
+	b.WriteString("| --- | --- | --- |\n")
+
+	row := func(symbol, kind string, pos Position) {
+		symbol = strings.ReplaceAll(symbol, "|", `\|`)
+		fmt.Fprintf(&b, "| `%s` | %s | %s |\n", symbol, kind, Link(pos, noteDir))
+	}
+	for _, item := range result.Structs {
+		row(item.Name, "struct", item.Position)
+	}
+	for _, item := range result.Interfaces {
+		row(item.Name, "interface", item.Position)
+	}
+	for _, decl := range result.Declarations {
+		kind := "func"
+		if decl.Receiver != "" {
+			kind = "method"
+		}
+		row(decl.Signature(), kind, decl.Start)
+	}
+	for _, item := range result.Constants {
+		row(item.Name, "const", item.Position)
+	}
+	for _, item := range result.Variables {
+		row(item.Name, "var", item.Position)
+	}
+	for _, item := range result.Channels {
+		row(item.Name, "channel", item.Position)
+	}
+	for _, item := range result.DeferStatements {
+		row("defer "+item.Name, "defer", item.Position)
+	}
+	for _, item := range result.PanicRecover {
+		row(item.Name, item.Name, item.Position)
+	}
+	return b.String()
+}
+
+// NoteMarkdown renders every section geek contributes to a file's note.
+func NoteMarkdown(result *AnalysisResult, noteDir string) string {
+	sections := []string{
+		SymbolsMarkdown(result, noteDir),
+		ConcurrencyMarkdown(result, noteDir),
+		MetricsMarkdown(result, noteDir),
+	}
+	var b strings.Builder
+	for _, section := range sections {
+		if section == "" {
+			continue
+		}
+		b.WriteString("\n" + section)
+	}
+	return b.String()
+}
+
+// PackageNoteMarkdown renders the note describing a whole package.
+func PackageNoteMarkdown(pkg *PackageResult, noteDir string) string {
+	sections := []string{
+		ModelsMarkdown(pkg, noteDir),
+		PayloadsMarkdown(pkg, noteDir),
+		EnumsMarkdown(pkg, noteDir),
+		ErrorSurfaceMarkdown(pkg, noteDir),
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Package %s\n", pkg.Path)
+	for _, section := range sections {
+		if section == "" {
+			continue
+		}
+		b.WriteString("\n" + section)
+	}
+	return b.String()
+}
+
+// AppendNote appends the sections of NoteMarkdown to the Markdown note at
+// notePath.
+func AppendNote(result *AnalysisResult, notePath string) error {
+	note, err := os.OpenFile(notePath, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer note.Close()
+
+	_, err = note.WriteString(NoteMarkdown(result, filepath.Dir(notePath)))
+	return err
+}
@@ -0,0 +1,439 @@
+package geek
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"math"
+	"sort"
+	"strings"
+)
+
+// FunctionMetrics are the size and complexity measures of one function.
+type FunctionMetrics struct {
+	Name            string  `json:"name"`
+	Cyclomatic      int     `json:"cyclomatic"`
+	Cognitive       int     `json:"cognitive"`
+	Nesting         int     `json:"nesting"`
+	LinesOfCode     int     `json:"linesOfCode"`
+	Params          int     `json:"params"`
+	Results         int     `json:"results"`
+	HalsteadVolume  float64 `json:"halsteadVolume"`
+	Maintainability float64 `json:"maintainability"`
+	Position
+}
+
+// Totals summarize the functions of a file or package.
+type Totals struct {
+	Functions       int     `json:"functions"`
+	LinesOfCode     int     `json:"linesOfCode"`
+	Cyclomatic      int     `json:"cyclomatic"`
+	MaxCyclomatic   int     `json:"maxCyclomatic"`
+	Cognitive       int     `json:"cognitive"`
+	MaxCognitive    int     `json:"maxCognitive"`
+	Maintainability float64 `json:"maintainability"`
+}
+
+// FileMetrics holds the metrics of every function in a file.
+type FileMetrics struct {
+	Functions []FunctionMetrics `json:"functions"`
+	Totals    Totals            `json:"totals"`
+}
+
+// computeMetrics measures every function declared in file.
+func computeMetrics(file *ast.File, at func(token.Pos) Position) *FileMetrics {
+	metrics := &FileMetrics{Functions: []FunctionMetrics{}}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		metrics.Functions = append(metrics.Functions, functionMetrics(fn, at))
+	}
+	metrics.Totals = totals(metrics.Functions)
+	return metrics
+}
+
+func functionMetrics(fn *ast.FuncDecl, at func(token.Pos) Position) FunctionMetrics {
+	m := FunctionMetrics{
+		Name:       funcDeclName(fn),
+		Cyclomatic: cyclomatic(fn.Body),
+		Cognitive:  cognitive(fn.Body, fn.Name.Name),
+		Nesting:    nesting(fn.Body, 0),
+		Params:     fieldCount(fn.Type.Params),
+		Results:    fieldCount(fn.Type.Results),
+		Position:   at(fn.Pos()),
+	}
+
+	// Lines that hold at least one token; blank and comment-only lines
+	// don't count
+	lines := map[int]bool{}
+	ast.Inspect(fn, func(n ast.Node) bool {
+		if n != nil {
+			lines[at(n.Pos()).Line] = true
+			lines[at(n.End()).Line] = true
+		}
+		return true
+	})
+	m.LinesOfCode = len(lines)
+
+	m.HalsteadVolume = halsteadVolume(fn)
+	m.Maintainability = maintainability(m.HalsteadVolume, m.Cyclomatic, m.LinesOfCode)
+	return m
+}
+
+func fieldCount(fields *ast.FieldList) int {
+	if fields == nil {
+		return 0
+	}
+	return fields.NumFields()
+}
+
+// cyclomatic is McCabe's complexity: one plus the number of decision
+// points. Function literals count towards the enclosing function.
+func cyclomatic(body *ast.BlockStmt) int {
+	complexity := 1
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			complexity++
+		case *ast.CaseClause:
+			if node.List != nil {
+				complexity++
+			}
+		case *ast.CommClause:
+			if node.Comm != nil {
+				complexity++
+			}
+		case *ast.BinaryExpr:
+			if node.Op == token.LAND || node.Op == token.LOR {
+				complexity++
+			}
+		}
+		return true
+	})
+	return complexity
+}
+
+// cognitive follows the cognitive complexity rules: breaks in linear flow
+// cost one, plus one for each level they are nested at; else branches,
+// sequences of mixed boolean operators, labelled jumps and recursion cost
+// one each.
+func cognitive(body *ast.BlockStmt, name string) int {
+	total := 0
+	var visit func(n ast.Node, level int)
+	visitAll := func(nodes []ast.Stmt, level int) {
+		for _, stmt := range nodes {
+			visit(stmt, level)
+		}
+	}
+	visit = func(n ast.Node, level int) {
+		switch node := n.(type) {
+		case nil:
+			return
+		case *ast.IfStmt:
+			total += 1 + level
+			visitIf(node, level, &total, visit)
+			return
+		case *ast.ForStmt:
+			total += 1 + level
+			visit(node.Cond, level)
+			visitAll(node.Body.List, level+1)
+			return
+		case *ast.RangeStmt:
+			total += 1 + level
+			visitAll(node.Body.List, level+1)
+			return
+		case *ast.SwitchStmt:
+			total += 1 + level
+			visit(node.Tag, level)
+			for _, clause := range node.Body.List {
+				visitAll(clause.(*ast.CaseClause).Body, level+1)
+			}
+			return
+		case *ast.TypeSwitchStmt:
+			total += 1 + level
+			for _, clause := range node.Body.List {
+				visitAll(clause.(*ast.CaseClause).Body, level+1)
+			}
+			return
+		case *ast.SelectStmt:
+			total += 1 + level
+			for _, clause := range node.Body.List {
+				visitAll(clause.(*ast.CommClause).Body, level+1)
+			}
+			return
+		case *ast.FuncLit:
+			visitAll(node.Body.List, level+1)
+			return
+		case *ast.BranchStmt:
+			if node.Label != nil {
+				total++
+			}
+		case *ast.BinaryExpr:
+			if node.Op == token.LAND || node.Op == token.LOR {
+				total += booleanSequences(node)
+				return
+			}
+		case *ast.CallExpr:
+			if ident, ok := node.Fun.(*ast.Ident); ok && ident.Name == name {
+				total++
+			}
+		}
+
+		// Everything else only matters for what it contains
+		ast.Inspect(n, func(child ast.Node) bool {
+			if child == nil || child == n {
+				return true
+			}
+			visit(child, level)
+			return false
+		})
+	}
+	visitAll(body.List, 0)
+	return total
+}
+
+// visitIf handles an if statement and its else-if chain, where each else
+// costs one without a nesting increment.
+func visitIf(node *ast.IfStmt, level int, total *int, visit func(ast.Node, int)) {
+	visit(node.Init, level)
+	visit(node.Cond, level)
+	for _, stmt := range node.Body.List {
+		visit(stmt, level+1)
+	}
+	switch els := node.Else.(type) {
+	case *ast.IfStmt:
+		*total++
+		visitIf(els, level, total, visit)
+	case *ast.BlockStmt:
+		*total++
+		for _, stmt := range els.List {
+			visit(stmt, level+1)
+		}
+	}
+}
+
+// booleanSequences counts the runs of like operators in a boolean
+// expression: a && b && c is one, a && b || c is two.
+func booleanSequences(expr ast.Expr) int {
+	var ops []token.Token
+	var flatten func(e ast.Expr)
+	flatten = func(e ast.Expr) {
+		if paren, ok := e.(*ast.ParenExpr); ok {
+			e = paren.X
+		}
+		bin, ok := e.(*ast.BinaryExpr)
+		if !ok || (bin.Op != token.LAND && bin.Op != token.LOR) {
+			return
+		}
+		flatten(bin.X)
+		ops = append(ops, bin.Op)
+		flatten(bin.Y)
+	}
+	flatten(expr)
+
+	count := 0
+	for i, op := range ops {
+		if i == 0 || ops[i-1] != op {
+			count++
+		}
+	}
+	return count
+}
+
+// nesting returns the deepest level of nested control structures.
+func nesting(n ast.Node, depth int) int {
+	deepest := depth
+	ast.Inspect(n, func(child ast.Node) bool {
+		if child == nil || child == n {
+			return true
+		}
+		switch node := child.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt,
+			*ast.TypeSwitchStmt, *ast.SelectStmt, *ast.FuncLit:
+			deepest = max(deepest, nesting(node, depth+1))
+			return false
+		}
+		return true
+	})
+	return deepest
+}
+
+// halsteadVolume estimates the Halstead volume from the syntax tree:
+// operators are operator tokens, keywords of statements and calls;
+// operands are identifiers and literals.
+func halsteadVolume(fn *ast.FuncDecl) float64 {
+	operators := map[string]int{}
+	operands := map[string]int{}
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch node := n.(type) {
+		case *ast.Ident:
+			operands[node.Name]++
+		case *ast.BasicLit:
+			operands[node.Value]++
+		case *ast.BinaryExpr:
+			operators[node.Op.String()]++
+		case *ast.UnaryExpr:
+			operators[node.Op.String()]++
+		case *ast.AssignStmt:
+			operators[node.Tok.String()]++
+		case *ast.IncDecStmt:
+			operators[node.Tok.String()]++
+		case *ast.CallExpr:
+			operators["()"]++
+		case *ast.IndexExpr:
+			operators["[]"]++
+		case *ast.SelectorExpr:
+			operators["."]++
+		case *ast.StarExpr:
+			operators["*"]++
+		case *ast.IfStmt:
+			operators["if"]++
+		case *ast.ForStmt:
+			operators["for"]++
+		case *ast.RangeStmt:
+			operators["range"]++
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt:
+			operators["switch"]++
+		case *ast.SelectStmt:
+			operators["select"]++
+		case *ast.ReturnStmt:
+			operators["return"]++
+		case *ast.GoStmt:
+			operators["go"]++
+		case *ast.DeferStmt:
+			operators["defer"]++
+		case *ast.SendStmt:
+			operators["<-"]++
+		case *ast.BranchStmt:
+			operators[node.Tok.String()]++
+		}
+		return true
+	})
+
+	vocabulary, length := 0, 0
+	for _, count := range operators {
+		vocabulary++
+		length += count
+	}
+	for _, count := range operands {
+		vocabulary++
+		length += count
+	}
+	if vocabulary == 0 {
+		return 0
+	}
+	return round(float64(length)*math.Log2(float64(vocabulary)), 1)
+}
+
+// maintainability is the maintainability index scaled to 0-100, as used by
+// Visual Studio: higher is easier to maintain, below 20 is hard.
+func maintainability(volume float64, cyclomatic, loc int) float64 {
+	if loc == 0 {
+		return 100
+	}
+	mi := 171 - 5.2*math.Log(math.Max(volume, 1)) - 0.23*float64(cyclomatic) - 16.2*math.Log(float64(loc))
+	return round(math.Max(0, mi*100/171), 1)
+}
+
+func round(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
+
+func totals(functions []FunctionMetrics) Totals {
+	t := Totals{Functions: len(functions), Maintainability: 100}
+	if len(functions) == 0 {
+		return t
+	}
+	mi := 0.0
+	for _, f := range functions {
+		t.LinesOfCode += f.LinesOfCode
+		t.Cyclomatic += f.Cyclomatic
+		t.MaxCyclomatic = max(t.MaxCyclomatic, f.Cyclomatic)
+		t.Cognitive += f.Cognitive
+		t.MaxCognitive = max(t.MaxCognitive, f.Cognitive)
+		// Weight by size so a few large functions dominate, as they should
+		mi += f.Maintainability * float64(f.LinesOfCode)
+	}
+	if t.LinesOfCode > 0 {
+		t.Maintainability = round(mi/float64(t.LinesOfCode), 1)
+	}
+	return t
+}
+
+// packageTotals combines the metrics of a package's files.
+func packageTotals(files map[string]*AnalysisResult) Totals {
+	var functions []FunctionMetrics
+	for _, name := range sortedKeys(files) {
+		if m := files[name].Metrics; m != nil {
+			functions = append(functions, m.Functions...)
+		}
+	}
+	return totals(functions)
+}
+
+// MetricsMarkdown renders the metrics table of a note, most complex
+// functions first.
+func MetricsMarkdown(result *AnalysisResult, noteDir string) string {
+	if result.Metrics == nil || len(result.Metrics.Functions) == 0 {
+		return ""
+	}
+	functions := append([]FunctionMetrics{}, result.Metrics.Functions...)
+	sortByComplexity(functions)
+
+	var b strings.Builder
+	b.WriteString("## Metrics\n\n")
+	b.WriteString("| Function | Cyclomatic | Cognitive | Nesting | LOC | Params | Results | Maintainability | Location |\n")
+	b.WriteString("| --- | --: | --: | --: | --: | --: | --: | --: | --- |\n")
+	for _, f := range functions {
+		fmt.Fprintf(&b, "| `%s` | %d | %d | %d | %d | %d | %d | %.1f | %s |\n", f.Name, f.Cyclomatic,
+			f.Cognitive, f.Nesting, f.LinesOfCode, f.Params, f.Results, f.Maintainability, Link(f.Position, noteDir))
+	}
+	t := result.Metrics.Totals
+	fmt.Fprintf(&b, "\nTotals: %d functions, %d lines of code, cyclomatic %d (max %d), cognitive %d (max %d), maintainability %.1f\n",
+		t.Functions, t.LinesOfCode, t.Cyclomatic, t.MaxCyclomatic, t.Cognitive, t.MaxCognitive, t.Maintainability)
+	return b.String()
+}
+
+func sortByComplexity(functions []FunctionMetrics) {
+	sort.SliceStable(functions, func(i, j int) bool {
+		if functions[i].Cognitive != functions[j].Cognitive {
+			return functions[i].Cognitive > functions[j].Cognitive
+		}
+		return functions[i].Cyclomatic > functions[j].Cyclomatic
+	})
+}
+
+// ComplexityReport renders the repo-wide "most complex functions" note
+// from the package analyses, listing at most limit functions.
+func ComplexityReport(pkgs []*PackageResult, limit int, noteDir string) string {
+	var functions []FunctionMetrics
+	var b strings.Builder
+	b.WriteString("# Most complex functions\n\n")
+	b.WriteString("| Package | Functions | LOC | Cyclomatic | Max cyclomatic | Cognitive | Max cognitive | Maintainability |\n")
+	b.WriteString("| --- | --: | --: | --: | --: | --: | --: | --: |\n")
+	for _, pkg := range pkgs {
+		t := pkg.Metrics
+		fmt.Fprintf(&b, "| `%s` | %d | %d | %d | %d | %d | %d | %.1f |\n", pkg.Path, t.Functions,
+			t.LinesOfCode, t.Cyclomatic, t.MaxCyclomatic, t.Cognitive, t.MaxCognitive, t.Maintainability)
+		for _, name := range sortedKeys(pkg.Files) {
+			if m := pkg.Files[name].Metrics; m != nil {
+				functions = append(functions, m.Functions...)
+			}
+		}
+	}
+
+	sortByComplexity(functions)
+	if len(functions) > limit {
+		functions = functions[:limit]
+	}
+	b.WriteString("\n| Function | Cognitive | Cyclomatic | Nesting | LOC | Maintainability | Location |\n")
+	b.WriteString("| --- | --: | --: | --: | --: | --: | --- |\n")
+	for _, f := range functions {
+		fmt.Fprintf(&b, "| `%s` | %d | %d | %d | %d | %.1f | %s |\n", f.Name, f.Cognitive,
+			f.Cyclomatic, f.Nesting, f.LinesOfCode, f.Maintainability, Link(f.Position, noteDir))
+	}
+	return b.String()
+}
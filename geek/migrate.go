@@ -0,0 +1,167 @@
+package geek
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ReadResult decodes an analysis written by any version of geek. Files
+// without a schemaVersion are from before versioning: their categories
+// are lists of bare strings, which become items without positions.
+func ReadResult(r io.Reader) (*AnalysisResult, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var header struct {
+		SchemaVersion int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case header.SchemaVersion == SchemaVersion:
+		var result AnalysisResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		return &result, nil
+	case header.SchemaVersion == 0 || header.SchemaVersion == 1:
+		return migrateV1(data)
+	default:
+		return nil, fmt.Errorf("unsupported analysis schema version %d (this build reads up to %d)", header.SchemaVersion, SchemaVersion)
+	}
+}
+
+// LoadResult reads an analysis JSON file from disk.
+func LoadResult(path string) (*AnalysisResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result, err := ReadResult(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return result, nil
+}
+
+// legacyList accepts a list whose elements are bare strings, as in version
+// 1, or objects, as written by the unversioned builds that added positions.
+type legacyList []json.RawMessage
+
+func (l legacyList) items() ([]Item, error) {
+	items := []Item{}
+	for _, raw := range l {
+		var name string
+		if err := json.Unmarshal(raw, &name); err == nil {
+			items = append(items, Item{Name: name})
+			continue
+		}
+		var item Item
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (l legacyList) comments() ([]Comment, error) {
+	comments := []Comment{}
+	for _, raw := range l {
+		var text string
+		if err := json.Unmarshal(raw, &text); err == nil {
+			comments = append(comments, Comment{Text: text})
+			continue
+		}
+		var comment Comment
+		if err := json.Unmarshal(raw, &comment); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, nil
+}
+
+func migrateV1(data []byte) (*AnalysisResult, error) {
+	var old struct {
+		PackageName     string        `json:"packageName"`
+		Imports         legacyList    `json:"imports"`
+		Structs         legacyList    `json:"structs"`
+		Variables       legacyList    `json:"variables"`
+		Constants       legacyList    `json:"constants"`
+		Comments        legacyList    `json:"comments"`
+		Interfaces      legacyList    `json:"interfaces"`
+		Methods         legacyList    `json:"methods"`
+		Channels        legacyList    `json:"channels"`
+		ErrorHandling   legacyList    `json:"errorHandling"`
+		TypeAssertions  legacyList    `json:"typeAssertions"`
+		ControlFlow     legacyList    `json:"controlFlow"`
+		DeferStatements legacyList    `json:"deferStatements"`
+		PanicRecover    legacyList    `json:"panicRecover"`
+		FunctionCalls   legacyList    `json:"functionCalls"`
+		Declarations    []Declaration `json:"declarations"`
+	}
+	if err := json.Unmarshal(data, &old); err != nil {
+		return nil, err
+	}
+
+	result := &AnalysisResult{
+		SchemaVersion: SchemaVersion,
+		PackageName:   old.PackageName,
+		Declarations:  old.Declarations,
+	}
+	if result.Declarations == nil {
+		result.Declarations = []Declaration{}
+	}
+
+	lists := []struct {
+		from legacyList
+		to   *[]Item
+	}{
+		{old.Imports, &result.Imports},
+		{old.Structs, &result.Structs},
+		{old.Variables, &result.Variables},
+		{old.Constants, &result.Constants},
+		{old.Interfaces, &result.Interfaces},
+		{old.Methods, &result.Methods},
+		{old.Channels, &result.Channels},
+		{old.TypeAssertions, &result.TypeAssertions},
+		{old.ControlFlow, &result.ControlFlow},
+		{old.DeferStatements, &result.DeferStatements},
+		{old.PanicRecover, &result.PanicRecover},
+		{old.FunctionCalls, &result.FunctionCalls},
+	}
+	for _, list := range lists {
+		items, err := list.from.items()
+		if err != nil {
+			return nil, err
+		}
+		*list.to = items
+	}
+
+	comments, err := old.Comments.comments()
+	if err != nil {
+		return nil, err
+	}
+	result.Comments = comments
+
+	// Version 1 flattened targets and callees into one list, so the
+	// grouping is lost; keep each name as its own entry
+	names, err := old.ErrorHandling.items()
+	if err != nil {
+		return nil, err
+	}
+	result.ErrorHandling = []Assignment{}
+	for _, item := range names {
+		result.ErrorHandling = append(result.ErrorHandling, Assignment{Targets: []string{item.Name}, Position: item.Position})
+	}
+	return result, nil
+}
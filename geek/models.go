@@ -0,0 +1,235 @@
+package geek
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Field is a field of a struct type.
+type Field struct {
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	Embedded bool              `json:"embedded,omitempty"`
+	Exported bool              `json:"exported"`
+	Tag      string            `json:"tag,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+	Position Position          `json:"position"`
+}
+
+// Struct tag keys whose values are recorded in Field.Tags
+var tagKeys = []string{"json", "yaml", "db"}
+
+// Relation kinds
+const (
+	RelationEmbeds      = "embeds"
+	RelationComposition = "composition"
+	RelationPointer     = "pointer"
+	RelationSlice       = "slice"
+	RelationMap         = "map"
+	RelationImplements  = "implements"
+)
+
+// Relation links two types of a package: From has a field of type To, or
+// implements the interface To. Field names the field the relation comes
+// from.
+type Relation struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Kind  string `json:"kind"`
+	Field string `json:"field,omitempty"`
+}
+
+// structFields lists the fields of a struct type.
+func (l *loader) structFields(s *types.Struct, qualifier types.Qualifier) []Field {
+	fields := []Field{}
+	for i := 0; i < s.NumFields(); i++ {
+		v := s.Field(i)
+		field := Field{
+			Name:     v.Name(),
+			Type:     types.TypeString(v.Type(), qualifier),
+			Embedded: v.Embedded(),
+			Exported: v.Exported(),
+			Tag:      s.Tag(i),
+			Position: l.position(v.Pos()),
+		}
+		tag := reflect.StructTag(field.Tag)
+		for _, key := range tagKeys {
+			if value, ok := tag.Lookup(key); ok {
+				if field.Tags == nil {
+					field.Tags = map[string]string{}
+				}
+				field.Tags[key] = value
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// relations finds how the named types of pkg refer to each other.
+func relations(pkg *types.Package, infos []TypeInfo) []Relation {
+	result := []Relation{}
+	scope := pkg.Scope()
+	local := func(t types.Type) string {
+		named, ok := t.(*types.Named)
+		if !ok || named.Obj().Pkg() != pkg || named.Obj().Parent() != scope {
+			return ""
+		}
+		return named.Obj().Name()
+	}
+
+	for _, info := range infos {
+		tn := scope.Lookup(info.Name).(*types.TypeName)
+		if s, ok := tn.Type().Underlying().(*types.Struct); ok {
+			for i := 0; i < s.NumFields(); i++ {
+				field := s.Field(i)
+				to, kind := fieldRelation(field.Type(), local)
+				if to == "" {
+					continue
+				}
+				if field.Embedded() {
+					kind = RelationEmbeds
+				}
+				result = append(result, Relation{From: info.Name, To: to, Kind: kind, Field: field.Name()})
+			}
+		}
+		for _, impl := range info.Implements {
+			if scope.Lookup(impl.Interface) != nil {
+				result = append(result, Relation{From: info.Name, To: impl.Interface, Kind: RelationImplements})
+			}
+		}
+	}
+	return result
+}
+
+// fieldRelation reports which local type a field of type t refers to, and
+// how.
+func fieldRelation(t types.Type, local func(types.Type) string) (string, string) {
+	switch t := t.(type) {
+	case *types.Pointer:
+		if to := local(t.Elem()); to != "" {
+			return to, RelationPointer
+		}
+	case *types.Slice:
+		to, _ := fieldRelation(t.Elem(), local)
+		return to, RelationSlice
+	case *types.Array:
+		to, _ := fieldRelation(t.Elem(), local)
+		return to, RelationSlice
+	case *types.Map:
+		to, _ := fieldRelation(t.Elem(), local)
+		return to, RelationMap
+	default:
+		if to := local(t); to != "" {
+			return to, RelationComposition
+		}
+	}
+	return "", ""
+}
+
+// Mermaid arrows for each relation kind
+var relationArrows = map[string]string{
+	RelationEmbeds:      "*--",
+	RelationComposition: "*--",
+	RelationPointer:     "o--",
+	RelationSlice:       `o-- "*"`,
+	RelationMap:         `o-- "*"`,
+	RelationImplements:  "..|>",
+}
+
+// ClassDiagram renders the package's structs and interfaces, with their
+// fields, methods and relations, as a Mermaid class diagram. It returns an
+// empty string when the package declares neither.
+func (pkg *PackageResult) ClassDiagram() string {
+	var b strings.Builder
+	classes := 0
+	for _, info := range pkg.Types {
+		if info.Kind != "struct" && info.Kind != "interface" {
+			continue
+		}
+		classes++
+		fmt.Fprintf(&b, "  class %s {\n", info.Name)
+		if info.Kind == "interface" {
+			b.WriteString("    <<interface>>\n")
+		}
+		for _, field := range info.Fields {
+			visibility := "-"
+			if field.Exported {
+				visibility = "+"
+			}
+			fmt.Fprintf(&b, "    %s%s %s\n", visibility, field.Name, classMember(field.Type))
+		}
+		methods := info.PointerMethods
+		if info.Kind == "interface" {
+			methods = info.Methods
+		}
+		for _, method := range methods {
+			visibility := "-"
+			if token.IsExported(method) {
+				visibility = "+"
+			}
+			fmt.Fprintf(&b, "    %s%s()\n", visibility, method)
+		}
+		b.WriteString("  }\n")
+	}
+	if classes == 0 {
+		return ""
+	}
+
+	rels := append([]Relation{}, pkg.Relations...)
+	sort.SliceStable(rels, func(i, j int) bool { return rels[i].From < rels[j].From })
+	for _, rel := range rels {
+		label := rel.Kind
+		if rel.Field != "" && rel.Kind != RelationEmbeds {
+			label = rel.Field
+		}
+		fmt.Fprintf(&b, "  %s %s %s : %s\n", rel.From, relationArrows[rel.Kind], rel.To, label)
+	}
+	return "classDiagram\n" + b.String()
+}
+
+// classMember makes a Go type safe inside a Mermaid class body, where
+// parentheses would turn a field of func type into a method.
+func classMember(typ string) string {
+	return strings.NewReplacer("(", "❨", ")", "❩").Replace(typ)
+}
+
+// ModelsMarkdown renders the "Data model" section of a package note: the
+// class diagram followed by the tagged fields of each struct.
+func ModelsMarkdown(pkg *PackageResult, noteDir string) string {
+	diagram := pkg.ClassDiagram()
+	if diagram == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("## Data model\n\n")
+	fmt.Fprintf(&b, "```mermaid\n%s```\n", diagram)
+
+	for _, info := range pkg.Types {
+		if info.Kind != "struct" || len(info.Fields) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n", info.Name)
+		b.WriteString("| Field | Type | json | yaml | db | Location |\n")
+		b.WriteString("| --- | --- | --- | --- | --- | --- |\n")
+		for _, field := range info.Fields {
+			name := field.Name
+			if field.Embedded {
+				name += " (embedded)"
+			}
+			cell := func(key string) string {
+				if value, ok := field.Tags[key]; ok {
+					return "`" + value + "`"
+				}
+				return ""
+			}
+			fmt.Fprintf(&b, "| `%s` | `%s` | %s | %s | %s | %s |\n", name,
+				strings.ReplaceAll(field.Type, "|", `\|`), cell("json"), cell("yaml"), cell("db"), Link(field.Position, noteDir))
+		}
+	}
+	return b.String()
+}
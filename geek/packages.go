@@ -0,0 +1,392 @@
+package geek
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+)
+
+// PackageResult is the type-checked view of a whole package. Positions of
+// types and calls use the same file paths as the keys of Files, so they can
+// be matched with the per-file AnalysisResult.
+type PackageResult struct {
+	Path         string                     `json:"path"`
+	Name         string                     `json:"name"`
+	Dir          string                     `json:"dir"`
+	Files        map[string]*AnalysisResult `json:"files"`
+	Types        []TypeInfo                 `json:"types"`
+	Calls        []CallTarget               `json:"calls"`
+	Metrics      Totals                     `json:"metrics"`
+	Relations    []Relation                 `json:"relations"`
+	Payloads     []Payload                  `json:"payloads"`
+	Enums        []Enum                     `json:"enums"`
+	States       []StateMachine             `json:"stateMachines"`
+	ErrorSurface *ErrorSurface              `json:"errorSurface"`
+	Errors       []string                   `json:"errors,omitempty"`
+}
+
+// TypeInfo describes a named type declared in the package.
+type TypeInfo struct {
+	Name             string           `json:"name"`
+	Kind             string           `json:"kind"`
+	Position         Position         `json:"position"`
+	Methods          []string         `json:"methods"`
+	PointerMethods   []string         `json:"pointerMethods"`
+	Embeds           []string         `json:"embeds"`
+	Fields           []Field          `json:"fields,omitempty"`
+	Implements       []Implementation `json:"implements"`
+	ImplementedBy    []string         `json:"implementedBy,omitempty"`
+	UnderlyingString string           `json:"underlying"`
+}
+
+// Implementation records that a type satisfies an interface, either as a
+// value or only through a pointer.
+type Implementation struct {
+	Interface string `json:"interface"`
+	Pointer   bool   `json:"pointer"`
+}
+
+// CallTarget is a call site resolved to what it actually calls.
+type CallTarget struct {
+	Position
+	Caller  string `json:"caller"`
+	Callee  string `json:"callee"`
+	Package string `json:"package,omitempty"`
+	Kind    string `json:"kind"`
+
+	// fn is the called function or method, when it is statically known
+	fn *types.Func
+}
+
+// Call kinds
+const (
+	CallFunction   = "function"
+	CallMethod     = "method"
+	CallInterface  = "interface"
+	CallBuiltin    = "builtin"
+	CallConversion = "conversion"
+	CallDynamic    = "dynamic"
+	CallLiteral    = "literal"
+)
+
+// AnalyzePackages type-checks every package under dir, which must be inside
+// a Go module. It works offline, resolving imports from the module itself,
+// its vendor directory, GOROOT and the module cache.
+func AnalyzePackages(dir string) ([]*PackageResult, error) {
+	l, err := newLoader(dir)
+	if err != nil {
+		return nil, err
+	}
+	pkgs, err := l.loadAll(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*PackageResult
+	for _, pkg := range pkgs {
+		results = append(results, l.analyzePackage(pkg))
+	}
+	return results, nil
+}
+
+// loadAll type-checks every package under dir.
+func (l *loader) loadAll(dir string) ([]*loadedPackage, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := moduleDirs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []*loadedPackage
+	for _, pkgDir := range dirs {
+		pkg, err := l.load(l.importPath(pkgDir), pkgDir, true)
+		if err != nil {
+			// Directories with only test or ignored files
+			continue
+		}
+		if pkg.Types == nil {
+			continue
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
+func (l *loader) analyzePackage(pkg *loadedPackage) *PackageResult {
+	result := &PackageResult{
+		Path:   pkg.Path,
+		Name:   pkg.Types.Name(),
+		Dir:    l.relPath(pkg.Dir),
+		Files:  map[string]*AnalysisResult{},
+		Types:  []TypeInfo{},
+		Calls:  []CallTarget{},
+		Errors: pkg.Errors,
+	}
+	for _, file := range pkg.Files {
+		name := l.relPath(l.fset.Position(file.Pos()).Filename)
+		analysis := analyzeFile(l.fset, file, name)
+		result.Files[name] = &analysis
+	}
+	result.Metrics = packageTotals(result.Files)
+	result.ErrorSurface = l.errorSurface(pkg)
+
+	qualifier := types.RelativeTo(pkg.Types)
+	candidates := candidateInterfaces(pkg.Types)
+
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || tn.IsAlias() {
+			continue
+		}
+		named, ok := tn.Type().(*types.Named)
+		if !ok {
+			continue
+		}
+
+		info := TypeInfo{
+			Name:             name,
+			Kind:             typeKind(named.Underlying()),
+			Position:         l.position(tn.Pos()),
+			Methods:          methodNames(types.NewMethodSet(named)),
+			PointerMethods:   methodNames(types.NewMethodSet(types.NewPointer(named))),
+			Embeds:           embeddedTypes(named.Underlying(), qualifier),
+			Implements:       []Implementation{},
+			UnderlyingString: types.TypeString(named.Underlying(), qualifier),
+		}
+		if s, ok := named.Underlying().(*types.Struct); ok {
+			info.Fields = l.structFields(s, qualifier)
+		}
+
+		if iface, ok := named.Underlying().(*types.Interface); ok {
+			// Which of this package's own types satisfy the interface
+			if iface.NumMethods() > 0 {
+				for _, other := range scope.Names() {
+					otn, ok := scope.Lookup(other).(*types.TypeName)
+					if !ok || otn == tn || types.IsInterface(otn.Type()) {
+						continue
+					}
+					if types.Implements(otn.Type(), iface) {
+						info.ImplementedBy = append(info.ImplementedBy, other)
+					} else if types.Implements(types.NewPointer(otn.Type()), iface) {
+						info.ImplementedBy = append(info.ImplementedBy, "*"+other)
+					}
+				}
+			}
+		} else {
+			for _, candidate := range candidates {
+				if candidate.Obj() == tn {
+					continue
+				}
+				iface := candidate.Underlying().(*types.Interface)
+				ifaceName := types.TypeString(candidate, qualifier)
+				if types.Implements(named, iface) {
+					info.Implements = append(info.Implements, Implementation{Interface: ifaceName})
+				} else if types.Implements(types.NewPointer(named), iface) {
+					info.Implements = append(info.Implements, Implementation{Interface: ifaceName, Pointer: true})
+				}
+			}
+		}
+		result.Types = append(result.Types, info)
+	}
+
+	result.Relations = relations(pkg.Types, result.Types)
+	result.Payloads = l.payloads(pkg.Types)
+	result.Enums = l.enums(pkg)
+	result.States = l.stateMachines(pkg, result.Enums)
+
+	for _, file := range pkg.Files {
+		result.Calls = append(result.Calls, l.resolveCalls(pkg, file)...)
+	}
+	return result
+}
+
+// relPath makes a path relative to the module root, with forward slashes.
+func (l *loader) relPath(path string) string {
+	rel, err := filepath.Rel(l.root, path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// position reports pos with its file relative to the module root.
+func (l *loader) position(pos token.Pos) Position {
+	p := l.fset.Position(pos)
+	return Position{File: l.relPath(p.Filename), Line: p.Line, Column: p.Column}
+}
+
+// candidateInterfaces returns the non-empty named interfaces a package's
+// types could implement: its own, those of the packages it imports, and
+// the predeclared error interface.
+func candidateInterfaces(pkg *types.Package) []*types.Named {
+	var result []*types.Named
+	add := func(scope *types.Scope, exportedOnly bool) {
+		for _, name := range scope.Names() {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || (exportedOnly && !tn.Exported()) {
+				continue
+			}
+			named, ok := tn.Type().(*types.Named)
+			if !ok || named.TypeParams().Len() > 0 {
+				continue
+			}
+			if iface, ok := named.Underlying().(*types.Interface); ok && iface.NumMethods() > 0 {
+				result = append(result, named)
+			}
+		}
+	}
+	add(pkg.Scope(), false)
+	for _, imp := range pkg.Imports() {
+		add(imp.Scope(), true)
+	}
+	result = append(result, types.Universe.Lookup("error").Type().(*types.Named))
+	return result
+}
+
+func typeKind(t types.Type) string {
+	switch t := t.(type) {
+	case *types.Struct:
+		return "struct"
+	case *types.Interface:
+		return "interface"
+	case *types.Signature:
+		return "func"
+	case *types.Map:
+		return "map"
+	case *types.Slice:
+		return "slice"
+	case *types.Array:
+		return "array"
+	case *types.Chan:
+		return "chan"
+	case *types.Pointer:
+		return "pointer"
+	case *types.Basic:
+		return t.Name()
+	default:
+		return "named"
+	}
+}
+
+func methodNames(ms *types.MethodSet) []string {
+	names := []string{}
+	for i := 0; i < ms.Len(); i++ {
+		names = append(names, ms.At(i).Obj().Name())
+	}
+	return names
+}
+
+// embeddedTypes lists the embedded fields of a struct or the embedded
+// elements of an interface.
+func embeddedTypes(t types.Type, qualifier types.Qualifier) []string {
+	embeds := []string{}
+	switch t := t.(type) {
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			if field := t.Field(i); field.Embedded() {
+				embeds = append(embeds, types.TypeString(field.Type(), qualifier))
+			}
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumEmbeddeds(); i++ {
+			embeds = append(embeds, types.TypeString(t.EmbeddedType(i), qualifier))
+		}
+	}
+	return embeds
+}
+
+// resolveCalls resolves every call in file to the object it invokes.
+func (l *loader) resolveCalls(pkg *loadedPackage, file *ast.File) []CallTarget {
+	var calls []CallTarget
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		caller := fn.Name.Name
+		if obj, ok := pkg.Info.Defs[fn.Name].(*types.Func); ok {
+			caller = obj.FullName()
+		}
+
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			target := resolveCall(pkg.Info, call)
+			target.Position = l.position(call.Pos())
+			target.Caller = caller
+			calls = append(calls, target)
+			return true
+		})
+	}
+	return calls
+}
+
+// resolveCall works out what a call expression invokes.
+func resolveCall(info *types.Info, call *ast.CallExpr) CallTarget {
+	fun := call.Fun
+	for {
+		paren, ok := fun.(*ast.ParenExpr)
+		if !ok {
+			break
+		}
+		fun = paren.X
+	}
+
+	// Explicit instantiations such as f[int](x)
+	switch f := fun.(type) {
+	case *ast.IndexExpr:
+		if tv, ok := info.Types[f]; !ok || !tv.IsType() {
+			fun = f.X
+		}
+	case *ast.IndexListExpr:
+		fun = f.X
+	}
+
+	if tv, ok := info.Types[fun]; ok && tv.IsType() {
+		return CallTarget{Callee: types.TypeString(tv.Type, nil), Kind: CallConversion}
+	}
+
+	var ident *ast.Ident
+	switch f := fun.(type) {
+	case *ast.FuncLit:
+		return CallTarget{Callee: "func literal", Kind: CallLiteral}
+	case *ast.Ident:
+		ident = f
+	case *ast.SelectorExpr:
+		ident = f.Sel
+	default:
+		return CallTarget{Callee: types.ExprString(fun), Kind: CallDynamic}
+	}
+
+	switch obj := info.Uses[ident].(type) {
+	case *types.Builtin:
+		return CallTarget{Callee: obj.Name(), Kind: CallBuiltin}
+	case *types.Func:
+		target := CallTarget{Callee: obj.FullName(), Kind: CallFunction, fn: obj}
+		if obj.Pkg() != nil {
+			target.Package = obj.Pkg().Path()
+		}
+		if sig, ok := obj.Type().(*types.Signature); ok && sig.Recv() != nil {
+			target.Kind = CallMethod
+			if types.IsInterface(sig.Recv().Type()) {
+				target.Kind = CallInterface
+			}
+		}
+		return target
+	case *types.Var:
+		// Function values: parameters, fields, variables
+		target := CallTarget{Callee: types.ExprString(fun), Kind: CallDynamic}
+		if obj.Pkg() != nil {
+			target.Package = obj.Pkg().Path()
+		}
+		return target
+	}
+	return CallTarget{Callee: types.ExprString(fun), Kind: CallDynamic}
+}
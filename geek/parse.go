@@ -0,0 +1,139 @@
+package geek
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+const parseMode = parser.ParseComments | parser.AllErrors
+
+// parseFile parses a Go source file. When the file has syntax errors the
+// parser usually gives up on everything after the first bad declaration, so
+// each top-level declaration is parsed again on its own and the pieces that
+// survive are stitched back into one file. The returned error describes the
+// syntax errors, if any; the file is nil only when nothing could be parsed.
+// src is the source; filename is only used for positions, and nil source
+// is empty rather than read from it.
+func parseFile(fset *token.FileSet, filename string, src []byte) (*ast.File, error) {
+	if src == nil {
+		src = []byte{}
+	}
+
+	file, err := parser.ParseFile(fset, filename, src, parseMode)
+	if err == nil || file == nil || file.Name == nil || file.Name.Name == "_" {
+		return file, err
+	}
+
+	// Offsets of the package clause, e.g. "package foo"
+	clauseStart := fset.Position(file.Package).Offset
+	clauseEnd := fset.Position(file.Name.End()).Offset
+	header := src[clauseStart:clauseEnd]
+
+	chunks := declChunks(src)
+	if len(chunks) < 2 {
+		return file, err
+	}
+
+	merged := &ast.File{
+		Doc:     file.Doc,
+		Package: file.Package,
+		Name:    file.Name,
+	}
+	seenComments := map[int]bool{}
+	for i, chunk := range chunks {
+		masked := maskOutside(src, chunk[0], chunk[1])
+		if i > 0 {
+			// Every chunk needs the package clause to be a valid file
+			copy(masked[clauseStart:], header)
+		}
+
+		part, _ := parser.ParseFile(fset, filename, masked, parseMode)
+		if part == nil {
+			continue
+		}
+		for _, decl := range part.Decls {
+			if _, bad := decl.(*ast.BadDecl); bad {
+				continue
+			}
+			merged.Decls = append(merged.Decls, decl)
+		}
+		merged.Imports = append(merged.Imports, part.Imports...)
+		for _, group := range part.Comments {
+			// Comments are keyed by offset so the copies of the package
+			// clause region in each chunk aren't counted twice
+			offset := fset.Position(group.Pos()).Offset
+			if seenComments[offset] {
+				continue
+			}
+			seenComments[offset] = true
+			merged.Comments = append(merged.Comments, group)
+		}
+	}
+	return merged, err
+}
+
+// declChunks splits src into byte ranges that each start at a top-level
+// declaration keyword (together with the comment lines right above it).
+// The first range covers everything before the first declaration.
+func declChunks(src []byte) [][2]int {
+	var starts []int
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	offset := 0
+	commentStart := -1
+	for _, line := range lines {
+		switch {
+		case bytes.HasPrefix(line, []byte("//")):
+			if commentStart < 0 {
+				commentStart = offset
+			}
+		case startsDecl(line):
+			start := offset
+			if commentStart >= 0 {
+				start = commentStart
+			}
+			if start > 0 {
+				starts = append(starts, start)
+			}
+			commentStart = -1
+		default:
+			commentStart = -1
+		}
+		offset += len(line)
+	}
+
+	var chunks [][2]int
+	prev := 0
+	for _, start := range starts {
+		chunks = append(chunks, [2]int{prev, start})
+		prev = start
+	}
+	return append(chunks, [2]int{prev, len(src)})
+}
+
+func startsDecl(line []byte) bool {
+	for _, kw := range []string{"func", "type", "var", "const", "import"} {
+		if bytes.HasPrefix(line, []byte(kw)) && len(line) > len(kw) {
+			switch line[len(kw)] {
+			case ' ', '\t', '(':
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maskOutside returns a copy of src where every byte outside [start, end)
+// is blanked, keeping newlines so positions stay the same.
+func maskOutside(src []byte, start, end int) []byte {
+	masked := make([]byte, len(src))
+	for i, b := range src {
+		if (i >= start && i < end) || b == '\n' {
+			masked[i] = b
+		} else {
+			masked[i] = ' '
+		}
+	}
+	return masked
+}
@@ -0,0 +1,391 @@
+package geek
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Payload is the JSON Schema and an example document for a struct that is
+// a wire format, which geek recognizes by its json tags.
+type Payload struct {
+	Type     string          `json:"type"`
+	Position Position        `json:"position"`
+	Schema   json.RawMessage `json:"schema"`
+	Example  json.RawMessage `json:"example"`
+}
+
+// payloads builds a Payload for every struct type of pkg with json tags.
+func (l *loader) payloads(pkg *types.Package) []Payload {
+	result := []Payload{}
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		tn, ok := scope.Lookup(name).(*types.TypeName)
+		if !ok || tn.IsAlias() {
+			continue
+		}
+		named, ok := tn.Type().(*types.Named)
+		if !ok || named.TypeParams().Len() > 0 || !hasJSONTags(named) {
+			continue
+		}
+
+		defs := &definitions{}
+		root := goTypeSchema(named, pkg, defs)
+		// Inline the root instead of referencing its own definition, which
+		// is only kept when the type refers to itself
+		for i, def := range *defs {
+			if def.name != name {
+				continue
+			}
+			root = &schema{}
+			*root = *def.schema
+			others := append((*defs)[:i:i], (*defs)[i+1:]...)
+			if refs, err := json.Marshal(append(properties{{schema: root}}, others...)); err == nil &&
+				!bytes.Contains(refs, []byte(`"`+defRef(name)+`"`)) {
+				*defs = others
+			}
+			break
+		}
+		root.Schema = "https://json-schema.org/draft/2020-12/schema"
+		root.Title = name
+		if len(*defs) > 0 {
+			root.Definitions = defs
+		}
+		schemaJSON, err := json.Marshal(root)
+		if err != nil {
+			continue
+		}
+		example, err := json.Marshal(exampleValue(named, name, map[*types.Named]bool{}))
+		if err != nil {
+			continue
+		}
+		result = append(result, Payload{
+			Type:     name,
+			Position: l.position(tn.Pos()),
+			Schema:   schemaJSON,
+			Example:  example,
+		})
+	}
+	return result
+}
+
+// hasJSONTags reports whether a struct type has a field with a json tag.
+func hasJSONTags(named *types.Named) bool {
+	s, ok := named.Underlying().(*types.Struct)
+	if !ok {
+		return false
+	}
+	for i := 0; i < s.NumFields(); i++ {
+		if _, ok := reflect.StructTag(s.Tag(i)).Lookup("json"); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonField is a struct field as encoding/json sees it.
+type jsonField struct {
+	name      string
+	omitempty bool
+	v         *types.Var
+}
+
+// jsonFields lists the fields encoding/json writes for s, flattening
+// embedded structs without a json name.
+func jsonFields(s *types.Struct) []jsonField {
+	var fields []jsonField
+	for i := 0; i < s.NumFields(); i++ {
+		v := s.Field(i)
+		tag := reflect.StructTag(s.Tag(i)).Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if v.Embedded() && name == "" {
+			t := v.Type()
+			if ptr, ok := t.(*types.Pointer); ok {
+				t = ptr.Elem()
+			}
+			if embedded, ok := t.Underlying().(*types.Struct); ok {
+				fields = append(fields, jsonFields(embedded)...)
+				continue
+			}
+		}
+		if !v.Exported() {
+			continue
+		}
+		if name == "" {
+			name = v.Name()
+		}
+		fields = append(fields, jsonField{name: name, omitempty: strings.Contains(opts, "omitempty"), v: v})
+	}
+	return fields
+}
+
+// isTime matches time.Time, which encodes as an RFC 3339 string.
+func isTime(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "time" && named.Obj().Name() == "Time"
+}
+
+// hasMethod reports whether t or *t has the method name.
+func hasMethod(t types.Type, name string) bool {
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), false, nil, name)
+	_, ok := obj.(*types.Func)
+	return ok
+}
+
+// goTypeSchema is the type-checker counterpart of typeSchema. It returns
+// nil for types encoding/json can't encode. Structs are defined once in
+// defs, under their name if they belong to pkg and under their package
+// path and name otherwise, so types of the same name don't collide.
+func goTypeSchema(t types.Type, pkg *types.Package, defs *definitions) *schema {
+	if isTime(t) {
+		return &schema{Type: "string", Format: "date-time"}
+	}
+	if named, ok := t.(*types.Named); ok {
+		// Custom encodings can't be described from the type alone
+		if hasMethod(named, "MarshalJSON") {
+			return &schema{}
+		}
+		if hasMethod(named, "MarshalText") {
+			return &schema{Type: "string"}
+		}
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsString != 0:
+			return &schema{Type: "string"}
+		case u.Info()&types.IsBoolean != 0:
+			return &schema{Type: "boolean"}
+		case u.Info()&types.IsInteger != 0:
+			return &schema{Type: "integer"}
+		case u.Info()&types.IsFloat != 0:
+			return &schema{Type: "number"}
+		}
+		return nil
+	case *types.Pointer:
+		return goTypeSchema(u.Elem(), pkg, defs)
+	case *types.Slice:
+		if isByte(u.Elem()) {
+			return &schema{Type: "string", Encoding: "base64"}
+		}
+		return &schema{Type: "array", Items: goTypeSchema(u.Elem(), pkg, defs)}
+	case *types.Array:
+		return &schema{Type: "array", Items: goTypeSchema(u.Elem(), pkg, defs)}
+	case *types.Map:
+		return &schema{Type: "object", Additional: goTypeSchema(u.Elem(), pkg, defs)}
+	case *types.Interface:
+		return &schema{}
+	case *types.Struct:
+		named, ok := t.(*types.Named)
+		if !ok {
+			return goStructSchema(u, pkg, defs)
+		}
+		name := named.Obj().Name()
+		if other := named.Obj().Pkg(); other != nil && other != pkg {
+			name = other.Path() + "." + name
+		}
+		for _, def := range *defs {
+			if def.name == name {
+				return &schema{Ref: defRef(name)}
+			}
+		}
+		*defs = append(*defs, property{name: name})
+		index := len(*defs) - 1
+		(*defs)[index].schema = goStructSchema(u, pkg, defs)
+		return &schema{Ref: defRef(name)}
+	}
+	return nil
+}
+
+// defRef refers to the definition called name, escaped as a JSON pointer.
+func defRef(name string) string {
+	return "#/$defs/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
+
+func goStructSchema(s *types.Struct, pkg *types.Package, defs *definitions) *schema {
+	result := &schema{Type: "object", Properties: &properties{}}
+	for _, field := range jsonFields(s) {
+		fieldSchema := goTypeSchema(field.v.Type(), pkg, defs)
+		if fieldSchema == nil {
+			continue
+		}
+		*result.Properties = append(*result.Properties, property{name: field.name, schema: fieldSchema})
+		if !field.omitempty {
+			result.Required = append(result.Required, field.name)
+		}
+	}
+	return result
+}
+
+func isByte(t types.Type) bool {
+	basic, ok := t.(*types.Basic)
+	return ok && basic.Kind() == types.Byte
+}
+
+// object is a JSON object that keeps its keys in order.
+type object []member
+
+type member struct {
+	name  string
+	value any
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(m.name)
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// Example strings for fields whose name contains the key as a word
+var exampleStrings = []struct{ key, value string }{
+	{"email", "jane@example.com"},
+	{"url", "https://example.com"},
+	{"uri", "https://example.com"},
+	{"endpoint", "https://example.com"},
+	{"password", "********"},
+	{"secret", "********"},
+	{"token", "********"},
+	{"role", "user"},
+	{"status", "active"},
+	{"state", "active"},
+	{"title", "Example title"},
+	{"content", "Hello, world!"},
+	{"message", "Hello, world!"},
+	{"text", "Hello, world!"},
+	{"description", "A short description."},
+	{"name", "example"},
+	{"id", "3f2b8c1e-5d4a-4e2b-9c7d-1a2b3c4d5e6f"},
+}
+
+// exampleValue makes up a plausible value of type t for a field called
+// name. Structs already being generated become null to stop recursion.
+func exampleValue(t types.Type, name string, active map[*types.Named]bool) any {
+	if isTime(t) {
+		return "2024-01-02T15:04:05Z"
+	}
+	named, isNamed := t.(*types.Named)
+	if isNamed && (hasMethod(named, "MarshalJSON") || hasMethod(named, "MarshalText")) {
+		return nil
+	}
+
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsString != 0:
+			for _, word := range words(name) {
+				for _, example := range exampleStrings {
+					if word == example.key {
+						return example.value
+					}
+				}
+			}
+			return "example"
+		case u.Info()&types.IsBoolean != 0:
+			return true
+		case u.Info()&types.IsInteger != 0:
+			return 42
+		case u.Info()&types.IsFloat != 0:
+			return 3.14
+		}
+		return nil
+	case *types.Pointer:
+		return exampleValue(u.Elem(), name, active)
+	case *types.Slice:
+		if isByte(u.Elem()) {
+			return []byte("example")
+		}
+		return []any{exampleValue(u.Elem(), name, active)}
+	case *types.Array:
+		return []any{exampleValue(u.Elem(), name, active)}
+	case *types.Map:
+		return object{{name: "key", value: exampleValue(u.Elem(), name, active)}}
+	case *types.Struct:
+		if isNamed {
+			if active[named] {
+				return nil
+			}
+			active[named] = true
+			defer delete(active, named)
+		}
+		o := object{}
+		for _, field := range jsonFields(u) {
+			if goTypeSchema(field.v.Type(), nil, &definitions{}) == nil {
+				continue
+			}
+			o = append(o, member{name: field.name, value: exampleValue(field.v.Type(), field.name, active)})
+		}
+		return o
+	}
+	return nil
+}
+
+// words splits a camelCase or snake_case identifier into lower-case words.
+func words(name string) []string {
+	var result []string
+	start := 0
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-':
+			if i > start {
+				result = append(result, strings.ToLower(string(runes[start:i])))
+			}
+			start = i + 1
+		case i > start && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) ||
+			(i+1 < len(runes) && unicode.IsLower(runes[i+1]))):
+			result = append(result, strings.ToLower(string(runes[start:i])))
+			start = i
+		}
+	}
+	if start < len(runes) {
+		result = append(result, strings.ToLower(string(runes[start:])))
+	}
+	return result
+}
+
+// PayloadsMarkdown renders the "JSON payloads" section of a package note.
+func PayloadsMarkdown(pkg *PackageResult, noteDir string) string {
+	if len(pkg.Payloads) == 0 {
+		return ""
+	}
+	indent := func(data json.RawMessage) string {
+		var b bytes.Buffer
+		if err := json.Indent(&b, data, "", "  "); err != nil {
+			return string(data)
+		}
+		return b.String()
+	}
+
+	var b strings.Builder
+	b.WriteString("## JSON payloads\n")
+	for _, payload := range pkg.Payloads {
+		fmt.Fprintf(&b, "\n### %s\n\n", payload.Type)
+		fmt.Fprintf(&b, "Declared at %s.\n\n", Link(payload.Position, noteDir))
+		fmt.Fprintf(&b, "Example:\n\n```json\n%s\n```\n\n", indent(payload.Example))
+		fmt.Fprintf(&b, "Schema:\n\n```json\n%s\n```\n", indent(payload.Schema))
+	}
+	return b.String()
+}
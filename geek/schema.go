@@ -0,0 +1,151 @@
+package geek
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// SchemaVersion is the version of the AnalysisResult JSON written by this
+// package. Version 1 is the original unversioned format where every
+// category was a list of bare strings.
+const SchemaVersion = 2
+
+// SchemaID identifies the published schema for the current version.
+const SchemaID = "https://github.com/hossam1231/documentor/geek/analysis.schema.json"
+
+// schema is a JSON Schema node. Properties keep the order of the Go struct
+// fields so the generated file is stable and diffs well.
+type schema struct {
+	Schema      string       `json:"$schema,omitempty"`
+	ID          string       `json:"$id,omitempty"`
+	Title       string       `json:"title,omitempty"`
+	Ref         string       `json:"$ref,omitempty"`
+	Type        string       `json:"type,omitempty"`
+	Format      string       `json:"format,omitempty"`
+	Encoding    string       `json:"contentEncoding,omitempty"`
+	Const       any          `json:"const,omitempty"`
+	Properties  *properties  `json:"properties,omitempty"`
+	Required    []string     `json:"required,omitempty"`
+	Items       *schema      `json:"items,omitempty"`
+	Additional  *schema      `json:"additionalProperties,omitempty"`
+	Definitions *definitions `json:"$defs,omitempty"`
+}
+
+type property struct {
+	name   string
+	schema *schema
+}
+
+type properties []property
+
+func (p properties) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, prop := range p {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(prop.name)
+		value, err := json.Marshal(prop.schema)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+type definitions = properties
+
+// JSONSchema generates the JSON Schema for AnalysisResult from its Go type,
+// so the published schema can't drift from what Run writes.
+func JSONSchema() ([]byte, error) {
+	defs := &definitions{}
+	root := structSchema(reflect.TypeOf(AnalysisResult{}), defs)
+	root.Schema = "https://json-schema.org/draft/2020-12/schema"
+	root.ID = SchemaID
+	root.Title = "geek analysis result"
+	root.Definitions = defs
+
+	// Pin the version so validators reject files from other versions
+	for i, prop := range *root.Properties {
+		if prop.name == "schemaVersion" {
+			(*root.Properties)[i].schema = &schema{Type: "integer", Const: SchemaVersion}
+		}
+	}
+
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func typeSchema(t reflect.Type, defs *definitions) *schema {
+	switch t.Kind() {
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.Pointer:
+		return typeSchema(t.Elem(), defs)
+	case reflect.Slice, reflect.Array:
+		return &schema{Type: "array", Items: typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return &schema{Type: "object", Additional: typeSchema(t.Elem(), defs)}
+	case reflect.Struct:
+		// Named structs go in $defs and are referenced from there
+		for _, def := range *defs {
+			if def.name == t.Name() {
+				return &schema{Ref: "#/$defs/" + t.Name()}
+			}
+		}
+		*defs = append(*defs, property{name: t.Name()})
+		index := len(*defs) - 1
+		(*defs)[index].schema = structSchema(t, defs)
+		return &schema{Ref: "#/$defs/" + t.Name()}
+	}
+	return &schema{}
+}
+
+// structSchema describes a struct's JSON object, flattening embedded
+// structs the way encoding/json does.
+func structSchema(t reflect.Type, defs *definitions) *schema {
+	s := &schema{Type: "object", Properties: &properties{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := structSchema(field.Type, defs)
+			*s.Properties = append(*s.Properties, *embedded.Properties...)
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		*s.Properties = append(*s.Properties, property{name: name, schema: typeSchema(field.Type, defs)})
+		if !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
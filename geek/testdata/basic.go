@@ -0,0 +1,101 @@
+package basic
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+import "strings"
+
+// Mode selects how files are written.
+const (
+	ModeCopy = iota
+	ModeLink
+)
+
+const greeting string = "hello"
+
+var (
+	counter int
+	config  struct {
+		Verbose bool
+	}
+)
+
+// Writer is anything that can flush.
+type Writer interface {
+	io.Writer
+	Flush() error
+}
+
+// Document is a note on disk.
+type Document struct {
+	Path  string
+	lines chan string
+}
+
+// func oldWrite(d *Document) error {
+// 	if d == nil {
+// 		return nil
+// 	}
+// }
+
+// Write copies the document to w.
+func (d *Document) Write(w Writer) error {
+	f, err := os.Open(d.Path)
+	if err != nil {
+		return err
+	} else {
+		defer f.Close()
+	}
+
+	var done chan<- bool
+	_ = done
+
+	for line := range d.lines {
+		fmt.Fprintln(w, strings.TrimSpace(line))
+	}
+	return w.Flush()
+}
+
+func (Document) Kind() string {
+	return "document"
+}
+
+func check(v interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println(r)
+		}
+	}()
+
+	switch v.(type) {
+	case string:
+	default:
+		panic("unexpected")
+	}
+
+	if s, ok := v.(fmt.Stringer); ok {
+		fmt.Println(s.String())
+	}
+
+	results := make(chan int)
+	select {
+	case n := <-results:
+		fmt.Println(n)
+	default:
+	}
+}
+
+// Map applies fn to every element of in.
+func Map[T, U any](in []T, fn func(T) U) (out []U) {
+	for _, v := range in {
+		out = append(out, fn(v))
+	}
+	return out
+}
+
+func join(sep string, parts ...string) string {
+	return strings.Join(parts, sep)
+}
@@ -0,0 +1,21 @@
+package broken
+
+import (
+	"fmt"
+	"os"
+)
+
+const Limit = 10
+
+func ok() {
+	fmt.Println("fine")
+}
+
+func missingBrace() {
+	if x := os.Getenv("X"); x != "" {
+		fmt.Println(x
+}
+
+type Later struct {
+	Name string
+}
@@ -0,0 +1,29 @@
+package calls
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type Store interface {
+	Get(key string) string
+}
+
+type memory struct{}
+
+func (memory) Get(key string) string {
+	return lookup(key)
+}
+
+func lookup(key string) string {
+	return fmt.Sprint(key)
+}
+
+func Fetch(s Store, key string, each func(string)) string {
+	each(key)
+	return s.Get(key)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprint(w, Fetch(memory{}, r.URL.Path, func(string) {}))
+}
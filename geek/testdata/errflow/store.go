@@ -0,0 +1,43 @@
+package errflow
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+var ErrNotFound = errors.New("not found")
+
+type QueryError struct {
+	Query string
+}
+
+func (e *QueryError) Error() string { return "bad query: " + e.Query }
+
+func Get(key string) (string, error) {
+	if key == "" {
+		return "", &QueryError{Query: key}
+	}
+	return "", fmt.Errorf("get %s: %w", key, ErrNotFound)
+}
+
+func Lookup(key string) string {
+	value, err := Get(key)
+	if errors.Is(err, ErrNotFound) {
+		return ""
+	}
+	if err != nil {
+		log.Fatalf("lookup: %v", err)
+	}
+	return value
+}
+
+func Cleanup(path string) {
+	os.Remove(path)
+	_ = os.Chdir(path)
+	fmt.Println("removed", path)
+}
+
+// Reset has an empty result list, which is valid Go
+func Reset() () {}
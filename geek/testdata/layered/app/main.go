@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/layered/core"
+)
+
+func main() {
+	fmt.Println(core.Run())
+}
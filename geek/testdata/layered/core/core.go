@@ -0,0 +1,10 @@
+package core
+
+import (
+	"example.com/layered/core/internal/secret"
+	"example.com/layered/store"
+)
+
+func Run() string {
+	return store.Load() + secret.Key
+}
@@ -0,0 +1,5 @@
+module example.com/layered
+
+go 1.21
+
+require example.org/dep v1.2.0
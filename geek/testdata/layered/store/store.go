@@ -0,0 +1,12 @@
+package store
+
+import (
+	"example.com/layered/core"
+	"example.com/layered/core/internal/secret"
+	"example.org/dep/client"
+)
+
+func Load() string {
+	_ = core.Run
+	return client.Get() + secret.Key
+}
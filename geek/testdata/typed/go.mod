@@ -0,0 +1,5 @@
+module example.com/typed
+
+go 1.21
+
+require example.org/missing v1.0.0
@@ -0,0 +1,66 @@
+package typed
+
+import (
+	"fmt"
+	"time"
+
+	"example.org/missing"
+)
+
+type Shape interface {
+	Area() float64
+}
+
+type Base struct {
+	Name string
+}
+
+func (b Base) String() string {
+	return b.Name
+}
+
+type Square struct {
+	Base
+	Side float64
+}
+
+func (s *Square) Area() float64 {
+	return s.Side * s.Side
+}
+
+type Circle struct {
+	Radius float64
+}
+
+func (c Circle) Area() float64 {
+	return 3 * c.Radius * c.Radius
+}
+
+func Total(shapes []Shape) float64 {
+	total := 0.0
+	for _, s := range shapes {
+		total += s.Area()
+	}
+	fmt.Println(len(shapes), float64(total), missing.Thing())
+	return total
+}
+
+type Canvas struct {
+	Title   string            `json:"title" yaml:"title"`
+	Shapes  []Shape           `json:"shapes,omitempty"`
+	Origin  *Circle           `json:"origin" db:"origin_id"`
+	Layers  map[string]Square `json:"-"`
+	primary Circle
+}
+
+type Event struct {
+	Base
+	ID       string            `json:"id"`
+	At       time.Time         `json:"at"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Retries  *int              `json:"retries,omitempty"`
+	Data     []byte            `json:"data"`
+	Origin   Circle            `json:"origin"`
+	Callback func()            `json:"-"`
+	internal string
+}
@@ -0,0 +1,82 @@
+package typed
+
+import "fmt"
+
+type State int
+
+const (
+	Idle State = iota
+	Running
+	Stopped
+)
+
+var stateNames = [...]string{"idle", "running", "stopped"}
+
+func (s State) String() string {
+	return stateNames[s]
+}
+
+type Level string
+
+const (
+	Low  Level = "low"
+	High Level = "high"
+)
+
+func (l Level) String() string {
+	switch l {
+	case Low:
+		return "LOW"
+	case High:
+		return "HIGH"
+	}
+	return "?"
+}
+
+type Machine struct {
+	state State
+}
+
+func (m *Machine) Step(stop bool) {
+	switch m.state {
+	case Idle:
+		m.state = Running
+	case Running:
+		if stop {
+			m.state = Stopped
+		}
+	}
+}
+
+func restart(s State) State {
+	switch s {
+	case Stopped:
+		return Idle
+	}
+	return s
+}
+
+// Mode is a string enum whose String builds a table that isn't indexed
+// by the values
+type Mode string
+
+const (
+	Debug   Mode = "debug"
+	Verbose Mode = "verbose"
+)
+
+func (m Mode) String() string {
+	return fmt.Sprint([]string{"mode", string(m)})
+}
+
+// Ratio is a float enum with the same kind of String
+type Ratio float64
+
+const (
+	Half Ratio = 0.5
+	Full Ratio = 1
+)
+
+func (r Ratio) String() string {
+	return fmt.Sprint([]string{"ratio"}, float64(r))
+}
@@ -0,0 +1,41 @@
+package workers
+
+import "sync"
+
+type Pool struct {
+	mu      sync.Mutex
+	jobs    chan int
+	results chan<- string
+	done    int
+}
+
+func (p *Pool) Start(n int) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range p.jobs {
+				p.results <- format(job)
+			}
+		}()
+	}
+	go p.watch()
+	wg.Wait()
+}
+
+func (p *Pool) watch() {
+	quit := make(chan struct{}, 1)
+	select {
+	case <-quit:
+	case p.jobs <- 0:
+	default:
+	}
+	p.mu.Lock()
+	p.done++
+	p.mu.Unlock()
+}
+
+func format(n int) string {
+	return string(rune(n))
+}
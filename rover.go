@@ -7,7 +7,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -31,7 +30,7 @@ func copyFileWithCodeBlock(src, dest, fileExtension string) error {
 		return nil
 	}
 
-	content, err := ioutil.ReadFile(src)
+	content, err := os.ReadFile(src)
 	if err != nil {
 		return err
 	}
@@ -50,7 +49,7 @@ type Message struct {
 
 func sendToCloudflare(mdFilename string) error {
     // Read Markdown file content
-    content, err := ioutil.ReadFile(mdFilename)
+    content, err := os.ReadFile(mdFilename)
     if err != nil {
         return err
     }
@@ -122,6 +121,30 @@ newContent := string(content) + "\n" + responseMarkdown
     return nil
 }
 
+// callGraph is the static call graph of the repository being documented
+var callGraph *geek.CallGraph
+
+// callChainDepth limits how many levels of calls each call-chain diagram shows
+const callChainDepth = 3
+
+// complexFunctions is how many functions the complexity report lists
+const complexFunctions = 25
+
+// appendToNote adds a Markdown section to the end of a note.
+func appendToNote(mdFilename, section string) error {
+	if section == "" {
+		return nil
+	}
+	note, err := os.OpenFile(mdFilename, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer note.Close()
+
+	_, err = note.WriteString("\n" + section)
+	return err
+}
+
 func findNearestGitignore(dir string) (string, error) {
 	for dir != "/" {
 		gitignorePath := filepath.Join(dir, ".gitignore")
@@ -134,7 +157,7 @@ func findNearestGitignore(dir string) (string, error) {
 }
 
 func isPathIgnored(path, gitignorePath string) (bool, error) {
-	gitignoreData, err := ioutil.ReadFile(gitignorePath)
+	gitignoreData, err := os.ReadFile(gitignorePath)
 	if err != nil {
 		return false, err
 	}
@@ -217,8 +240,14 @@ if ext == ".md" {
 
 mdCounterpart := filepath.Join(filepath.Dir(path), filepath.Base(path[0:len(path)-len(ext)])+".md")
 if _, err := os.Stat(mdCounterpart); err == nil {
-	fmt.Printf("Skipping %s (File with .md counterpart exists)\n", path)
-	return nil
+	// Notes rover generated say what from, so stale ones can be redone;
+	// other Markdown counterparts are left alone
+	if problem, err := doctor.CheckNote(path); err == nil && problem != nil && problem.Status == doctor.NoteStale && problem.Source == filepath.Clean(path) {
+		fmt.Printf("Regenerating %s (note is stale)\n", mdCounterpart)
+	} else {
+		fmt.Printf("Skipping %s (File with .md counterpart exists)\n", path)
+		return nil
+	}
 }
 
 
@@ -238,15 +267,47 @@ if _, err := os.Stat(mdCounterpart); err == nil {
 		return err
 	}
 
-	 // Run geek.Run(filepath) after processing the file
-    geekFilePath := filepath.Join(filepath.Dir(path), filepath.Base(path[0:len(path)-len(filepath.Ext(path))])+".go")
-    fmt.Printf("Running geek.Run(%s)\n", geekFilePath)
-    geek.Run(geekFilePath)
+	// Analyze the source with geek after processing the file
+	geekFilePath := filepath.Join(filepath.Dir(path), filepath.Base(path[0:len(path)-len(filepath.Ext(path))])+".go")
+	fmt.Printf("Analyzing %s\n", geekFilePath)
+	result, err := geek.Analyze(geekFilePath, geek.Options{})
+	if err != nil {
+		fmt.Printf("Could not analyze %s: %v\n", geekFilePath, err)
+	} else {
+		jsonPath := geek.JSONPath(geekFilePath)
+		if err := geek.WriteJSON(result, jsonPath); err != nil {
+			fmt.Printf("Could not write %s: %v\n", jsonPath, err)
+		} else {
+			fmt.Println("Analysis result written to", jsonPath)
+		}
+
+		// Add geek's sections, which link back to lines in the source
+		if err := geek.AppendNote(result, mdFilename); err != nil {
+			fmt.Printf("Could not add analysis to %s: %v\n", mdFilename, err)
+		}
+
+		if callGraph != nil {
+			if err := appendToNote(mdFilename, callGraph.CallChainsMarkdown(geekFilePath, callChainDepth)); err != nil {
+				fmt.Printf("Could not add call chains to %s: %v\n", mdFilename, err)
+			}
+		}
+	}
+
+	// Record what the note was generated from, for rover doctor -notes
+	if stamp, err := doctor.NewNoteStamp(path); err != nil {
+		fmt.Printf("Could not stamp %s: %v\n", mdFilename, err)
+	} else if err := appendToNote(mdFilename, stamp.String()); err != nil {
+		fmt.Printf("Could not stamp %s: %v\n", mdFilename, err)
+	}
 
-		 // Run geek.Run(filepath) after processing the file
-    doctorFilePath := filepath.Join(filepath.Dir(path), filepath.Base(path[0:len(path)-len(filepath.Ext(path))])+".go")
-    fmt.Printf("Running geek.Run(%s)\n", doctorFilePath)
-    doctor.Run(doctorFilePath)
+	// Check the file with doctor's rules once geek's analysis is on disk
+	doctorFilePath := filepath.Join(filepath.Dir(path), filepath.Base(path[0:len(path)-len(filepath.Ext(path))])+".go")
+	fmt.Printf("Running doctor on %s\n", doctorFilePath)
+	if findings, err := doctor.Run(doctorFilePath); err != nil {
+		fmt.Printf("Could not check %s: %v\n", doctorFilePath, err)
+	} else {
+		fmt.Printf("%d findings written to %s\n", len(findings), doctor.ReportPath(doctorFilePath))
+	}
 
 
 
@@ -279,14 +340,138 @@ if _, err := os.Stat(mdCounterpart); err == nil {
 // }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "api":
+			if err := runAPI(os.Args[2:]); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			return
+		case "apidiff":
+			breaking, err := runAPIDiff(os.Args[2:])
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			if breaking {
+				os.Exit(1)
+			}
+			return
+		case "doctor":
+			failed, err := runDoctor(os.Args[2:])
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			if failed {
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	if len(os.Args) != 2 {
 		fmt.Println("Usage: go run main.go <repository_path>")
+		fmt.Println("       go run main.go api [-o file] [dir]")
+		fmt.Println("       go run main.go apidiff [-C dir] [-json] <old> <new>")
+		fmt.Println("       go run main.go doctor [-fix [-y]] [-fail-on severity] [-write-baseline] [-write-reports] [-min-doc-coverage percent] [-o format=path ...] [file or dir ...]")
+		fmt.Println("       go run main.go doctor -notes [file or dir ...]")
 		return
 	}
 
 	repoPath := os.Args[1]
-	err := filepath.Walk(repoPath, processFile)
+
+	// The call graph spans the whole module, so build it once up front
+	graph, err := geek.BuildCallGraph(repoPath)
+	if err != nil {
+		fmt.Println("Could not build call graph:", err)
+	}
+	callGraph = graph
+
+	err = filepath.Walk(repoPath, processFile)
 	if err != nil {
 		fmt.Println("Error:", err)
 	}
+
+	if err := writeArchitecture(repoPath); err != nil {
+		fmt.Println("Error writing architecture note:", err)
+	}
+
+	pkgs, err := geek.AnalyzePackages(repoPath)
+	if err != nil {
+		fmt.Println("Could not analyze packages:", err)
+		return
+	}
+	if err := writePackageNotes(repoPath, pkgs); err != nil {
+		fmt.Println("Error writing package notes:", err)
+	}
+	if err := writeComplexity(repoPath, pkgs); err != nil {
+		fmt.Println("Error writing complexity note:", err)
+	}
+	if err := writeDuplicates(repoPath); err != nil {
+		fmt.Println("Error writing duplicate code note:", err)
+	}
+	if _, err := checkDocCoverage(repoPath, -1, true); err != nil {
+		fmt.Println("Error writing documentation coverage note:", err)
+	}
+	if err := writeHealth(repoPath); err != nil {
+		fmt.Println("Error writing health note:", err)
+	}
+}
+
+// writeArchitecture writes the repo-level import graph next to the notes.
+func writeArchitecture(repoPath string) error {
+	layers, err := geek.LoadLayers(filepath.Join(repoPath, ".documentor.json"))
+	if err != nil {
+		return err
+	}
+	graph, err := geek.BuildImportGraph(repoPath, geek.GraphOptions{Layers: layers})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Writing architecture note to %s\n", filepath.Join(repoPath, "architecture.md"))
+	return graph.WriteArchitecture(repoPath)
+}
+
+// writeComplexity writes the repo-wide list of the most complex functions.
+func writeComplexity(repoPath string, pkgs []*geek.PackageResult) error {
+	// The functions' positions are relative to the module root, so the
+	// links are made from the note's directory relative to it too
+	root, err := geek.ModuleRoot(repoPath)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.Abs(repoPath)
+	if err != nil {
+		return err
+	}
+	noteDir, err := filepath.Rel(root, dir)
+	if err != nil {
+		return err
+	}
+	notePath := filepath.Join(repoPath, "complexity.md")
+	fmt.Printf("Writing complexity note to %s\n", notePath)
+	return os.WriteFile(notePath, []byte(geek.ComplexityReport(pkgs, complexFunctions, noteDir)), 0644)
+}
+
+// packageNote is the name of the note written into every package directory
+const packageNote = "_package.md"
+
+// writePackageNotes writes a note describing each package into its
+// directory. The packages' directories are relative to the module root,
+// which repoPath may be below.
+func writePackageNotes(repoPath string, pkgs []*geek.PackageResult) error {
+	root, err := geek.ModuleRoot(repoPath)
+	if err != nil {
+		return err
+	}
+	for _, pkg := range pkgs {
+		notePath := filepath.Join(root, filepath.FromSlash(pkg.Dir), packageNote)
+		fmt.Printf("Writing package note to %s\n", notePath)
+		if err := os.WriteFile(notePath, []byte(geek.PackageNoteMarkdown(pkg, pkg.Dir)), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -4,7 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -28,7 +28,7 @@ func copyFileWithCodeBlock(src, dest, fileExtension string) error {
 		return nil
 	}
 
-	content, err := ioutil.ReadFile(src)
+	content, err := os.ReadFile(src)
 	if err != nil {
 		return err
 	}
@@ -36,7 +36,7 @@ func copyFileWithCodeBlock(src, dest, fileExtension string) error {
 	// Wrap the content with the specified markdown code block without the dot in the file extension
 	wrappedContent := fmt.Sprintf("```%s\n\n%s\n\n```\n", fileExtension, string(content))
 
-	return ioutil.WriteFile(dest, []byte(wrappedContent), 0644)
+	return os.WriteFile(dest, []byte(wrappedContent), 0644)
 }
 
 
@@ -47,7 +47,7 @@ type Message struct {
 
 func sendToCloudflare(mdFilename string) error {
     // Read Markdown file content
-    content, err := ioutil.ReadFile(mdFilename)
+    content, err := os.ReadFile(mdFilename)
     if err != nil {
         return err
     }
@@ -90,7 +90,7 @@ var result struct {
     } `json:"result"`
 }
 
-  responseBody, err := ioutil.ReadAll(resp.Body)
+  responseBody, err := io.ReadAll(resp.Body)
     if err != nil {
         log.Fatalf("Error reading response body: %v", err)
         return err
@@ -131,7 +131,7 @@ func findNearestGitignore(dir string) (string, error) {
 }
 
 func isPathIgnored(path, gitignorePath string) (bool, error) {
-	gitignoreData, err := ioutil.ReadFile(gitignorePath)
+	gitignoreData, err := os.ReadFile(gitignorePath)
 	if err != nil {
 		return false, err
 	}